@@ -0,0 +1,273 @@
+package concepts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/exp/slices"
+)
+
+// Scopes of the changes an annotations rule applies to
+const (
+	CanonicalScope = "canonical"
+	SourceScope    = "source"
+	AnyScope       = "any"
+)
+
+// Relationship changes an annotations rule can require
+const (
+	RelationshipChanged = "changed"
+	RelationshipAdded   = "added"
+	RelationshipRemoved = "removed"
+)
+
+// AnnotationsRule decides whether a change of a concept affects its annotations. A rule matches either the change log
+// entries at or below one of its Paths, or a change of the concepts related through its Relationship condition.
+type AnnotationsRule struct {
+	Name string `json:"name"`
+	// ConceptTypes restricts the rule to concepts of these types, before or after the change
+	ConceptTypes []string `json:"conceptTypes,omitempty"`
+	// Scope is canonical (the default), source or any
+	Scope string `json:"scope,omitempty"`
+	// Paths are JSON Pointers, as in the change log
+	Paths []string `json:"paths,omitempty"`
+	// Ops restricts the rule to the change log operations add, remove and replace
+	Ops          []string               `json:"ops,omitempty"`
+	Relationship *RelationshipCondition `json:"relationship,omitempty"`
+}
+
+// RelationshipCondition matches when the concepts related to the source representations through Field change. Field
+// holds either uuids or objects with a uuid, of which only those with all the properties of Where are considered.
+type RelationshipCondition struct {
+	Field string                 `json:"field"`
+	Where map[string]interface{} `json:"where,omitempty"`
+	// Change is changed (the default), added or removed
+	Change string `json:"change,omitempty"`
+}
+
+type annotationsRulesFile struct {
+	Rules []AnnotationsRule `json:"rules"`
+}
+
+// AnnotationsRules holds the rules deciding whether a change of a concept affects its annotations. They can be
+// reloaded from their file while the service is running.
+type AnnotationsRules struct {
+	path  string
+	rules atomic.Pointer[[]AnnotationsRule]
+}
+
+// NewAnnotationsRules returns fixed rules
+func NewAnnotationsRules(rules ...AnnotationsRule) (*AnnotationsRules, error) {
+	if err := validateAnnotationsRules(rules); err != nil {
+		return nil, err
+	}
+	r := &AnnotationsRules{}
+	r.rules.Store(&rules)
+	return r, nil
+}
+
+// DefaultAnnotationsRules returns the rules used without a rules file: a change of one of the top level fields of the
+// canonical concept, or of the NAICS industry classification with rank 1 of a source representation.
+func DefaultAnnotationsRules(fields []string) *AnnotationsRules {
+	paths := make([]string, 0, len(fields))
+	for _, field := range fields {
+		paths = append(paths, jsonPointer([]string{field}))
+	}
+	rules := []AnnotationsRule{
+		{Name: "annotationsChangeFields", Paths: paths},
+		{Name: "naicsRank1", Relationship: &RelationshipCondition{Field: "naicsIndustryClassifications", Where: map[string]interface{}{"rank": float64(1)}}},
+	}
+	r := &AnnotationsRules{}
+	r.rules.Store(&rules)
+	return r
+}
+
+// LoadAnnotationsRules reads the rules from a JSON file of the form {"rules": [...]}
+func LoadAnnotationsRules(path string) (*AnnotationsRules, error) {
+	r := &AnnotationsRules{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the rules from their file again, keeping the current ones if the file is invalid
+func (r *AnnotationsRules) Reload() error {
+	if r.path == "" {
+		return errors.New("the annotations rules were not loaded from a file")
+	}
+	body, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var file annotationsRulesFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return fmt.Errorf("invalid annotations rules file %s: %w", r.path, err)
+	}
+	if err := validateAnnotationsRules(file.Rules); err != nil {
+		return fmt.Errorf("invalid annotations rules file %s: %w", r.path, err)
+	}
+	r.rules.Store(&file.Rules)
+	return nil
+}
+
+// Rules returns the current rules
+func (r *AnnotationsRules) Rules() []AnnotationsRule {
+	if rules := r.rules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// AnnotationsChange reports whether any rule matches the change between the mappified concepts
+func (r *AnnotationsRules) AnnotationsChange(existing, updated map[string]interface{}, changelog ChangeLog) bool {
+	for _, rule := range r.Rules() {
+		if rule.matches(existing, updated, changelog) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateAnnotationsRules(rules []AnnotationsRule) error {
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if len(rule.Paths) == 0 && rule.Relationship == nil {
+			return fmt.Errorf("rule %s has neither paths nor a relationship", rule.Name)
+		}
+		if len(rule.Paths) > 0 && rule.Relationship != nil {
+			return fmt.Errorf("rule %s has both paths and a relationship", rule.Name)
+		}
+		switch rule.Scope {
+		case "", CanonicalScope, SourceScope, AnyScope:
+		default:
+			return fmt.Errorf("rule %s has an unknown scope %q", rule.Name, rule.Scope)
+		}
+		for _, path := range rule.Paths {
+			if path != "" && !strings.HasPrefix(path, "/") {
+				return fmt.Errorf("rule %s has an invalid JSON Pointer %q", rule.Name, path)
+			}
+		}
+		for _, op := range rule.Ops {
+			if op != ChangeLogAdd && op != ChangeLogRemove && op != ChangeLogReplace {
+				return fmt.Errorf("rule %s has an unknown op %q", rule.Name, op)
+			}
+		}
+		if rel := rule.Relationship; rel != nil {
+			if rel.Field == "" {
+				return fmt.Errorf("rule %s has a relationship without a field", rule.Name)
+			}
+			switch rel.Change {
+			case "", RelationshipChanged, RelationshipAdded, RelationshipRemoved:
+			default:
+				return fmt.Errorf("rule %s has an unknown relationship change %q", rule.Name, rel.Change)
+			}
+		}
+	}
+	return nil
+}
+
+func (rule AnnotationsRule) matches(existing, updated map[string]interface{}, changelog ChangeLog) bool {
+	if len(rule.ConceptTypes) > 0 && !slices.Contains(rule.ConceptTypes, mappifiedType(existing)) && !slices.Contains(rule.ConceptTypes, mappifiedType(updated)) {
+		return false
+	}
+	if rule.Relationship != nil {
+		return rule.Relationship.matches(existing, updated)
+	}
+	for _, entry := range changelog {
+		if rule.matchesEntry(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule AnnotationsRule) matchesEntry(entry ChangeLogEntry) bool {
+	switch rule.Scope {
+	case "", CanonicalScope:
+		if entry.SourceUUID != "" {
+			return false
+		}
+	case SourceScope:
+		if entry.SourceUUID == "" {
+			return false
+		}
+	}
+	if len(rule.Ops) > 0 && !slices.Contains(rule.Ops, entry.Op) {
+		return false
+	}
+	for _, path := range rule.Paths {
+		// the empty path is the whole document, so a rule matches every change below its path
+		if entry.Path == path || strings.HasPrefix(entry.Path, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (rel RelationshipCondition) matches(existing, updated map[string]interface{}) bool {
+	before := rel.related(existing)
+	after := rel.related(updated)
+	added, removed := false, false
+	for uuid := range after {
+		if !before[uuid] {
+			added = true
+		}
+	}
+	for uuid := range before {
+		if !after[uuid] {
+			removed = true
+		}
+	}
+	switch rel.Change {
+	case RelationshipAdded:
+		return added
+	case RelationshipRemoved:
+		return removed
+	}
+	return added || removed
+}
+
+// related returns the uuids of the concepts related to the source representations of the mappified concept
+func (rel RelationshipCondition) related(concept map[string]interface{}) map[string]bool {
+	uuids := map[string]bool{}
+	sources, _ := concept["sourceRepresentations"].([]interface{})
+	for _, s := range sources {
+		source, _ := s.(map[string]interface{})
+		values, _ := source[rel.Field].([]interface{})
+		for _, value := range values {
+			switch v := value.(type) {
+			case string:
+				if len(rel.Where) == 0 {
+					uuids[v] = true
+				}
+			case map[string]interface{}:
+				if uuid, ok := v["uuid"].(string); ok && rel.holds(v) {
+					uuids[uuid] = true
+				}
+			}
+		}
+	}
+	return uuids
+}
+
+func (rel RelationshipCondition) holds(properties map[string]interface{}) bool {
+	for key, value := range rel.Where {
+		if !reflect.DeepEqual(properties[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+func mappifiedType(concept map[string]interface{}) string {
+	t, _ := concept["type"].(string)
+	return t
+}
@@ -0,0 +1,130 @@
+package concepts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationsRules(t *testing.T) {
+	organisation := func(prefLabel string, sources ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "Organisation", "prefLabel": prefLabel, "sourceRepresentations": sources}
+	}
+	source := func(fields map[string]interface{}) map[string]interface{} {
+		fields["uuid"] = "uuid-1"
+		return fields
+	}
+	naics := func(uuid string, rank float64) map[string]interface{} {
+		return map[string]interface{}{"uuid": uuid, "rank": rank}
+	}
+
+	tests := []struct {
+		name     string
+		rule     AnnotationsRule
+		existing map[string]interface{}
+		updated  map[string]interface{}
+		expected bool
+	}{
+		{
+			name:     "Canonical path",
+			rule:     AnnotationsRule{Name: "labels", Paths: []string{"/prefLabel"}},
+			existing: organisation("Old"),
+			updated:  organisation("New"),
+			expected: true,
+		},
+		{
+			name:     "Canonical path ignores sources",
+			rule:     AnnotationsRule{Name: "labels", Paths: []string{"/prefLabel"}},
+			existing: organisation("Label", source(map[string]interface{}{"prefLabel": "Old"})),
+			updated:  organisation("Label", source(map[string]interface{}{"prefLabel": "New"})),
+			expected: false,
+		},
+		{
+			name:     "Source scope",
+			rule:     AnnotationsRule{Name: "labels", Scope: SourceScope, Paths: []string{"/prefLabel"}},
+			existing: organisation("Label", source(map[string]interface{}{"prefLabel": "Old"})),
+			updated:  organisation("Label", source(map[string]interface{}{"prefLabel": "New"})),
+			expected: true,
+		},
+		{
+			name:     "Nested path",
+			rule:     AnnotationsRule{Name: "aliases", Paths: []string{"/aliases"}},
+			existing: map[string]interface{}{"aliases": []interface{}{"one"}},
+			updated:  map[string]interface{}{"aliases": []interface{}{"one", "two"}},
+			expected: true,
+		},
+		{
+			name:     "Ops",
+			rule:     AnnotationsRule{Name: "aliases", Paths: []string{"/aliases"}, Ops: []string{ChangeLogRemove}},
+			existing: map[string]interface{}{"aliases": []interface{}{"one"}},
+			updated:  map[string]interface{}{"aliases": []interface{}{"one", "two"}},
+			expected: false,
+		},
+		{
+			name:     "Other concept types",
+			rule:     AnnotationsRule{Name: "labels", ConceptTypes: []string{"Person"}, Paths: []string{"/prefLabel"}},
+			existing: organisation("Old"),
+			updated:  organisation("New"),
+			expected: false,
+		},
+		{
+			name:     "NAICS rank 1 changed",
+			rule:     DefaultAnnotationsRules(nil).Rules()[1],
+			existing: organisation("Label", source(map[string]interface{}{"naicsIndustryClassifications": []interface{}{naics("naics-1", 1), naics("naics-2", 2)}})),
+			updated:  organisation("Label", source(map[string]interface{}{"naicsIndustryClassifications": []interface{}{naics("naics-2", 1), naics("naics-1", 2)}})),
+			expected: true,
+		},
+		{
+			name:     "NAICS of other ranks changed",
+			rule:     DefaultAnnotationsRules(nil).Rules()[1],
+			existing: organisation("Label", source(map[string]interface{}{"naicsIndustryClassifications": []interface{}{naics("naics-1", 1), naics("naics-2", 2)}})),
+			updated:  organisation("Label", source(map[string]interface{}{"naicsIndustryClassifications": []interface{}{naics("naics-1", 1), naics("naics-3", 2)}})),
+			expected: false,
+		},
+		{
+			name:     "HAS_FOCUS added",
+			rule:     AnnotationsRule{Name: "focus", Relationship: &RelationshipCondition{Field: "hasFocusUUIDs", Change: RelationshipAdded}},
+			existing: organisation("Label", source(map[string]interface{}{"hasFocusUUIDs": []interface{}{"focus-1"}})),
+			updated:  organisation("Label", source(map[string]interface{}{"hasFocusUUIDs": []interface{}{"focus-1", "focus-2"}})),
+			expected: true,
+		},
+		{
+			name:     "HAS_FOCUS removed",
+			rule:     AnnotationsRule{Name: "focus", Relationship: &RelationshipCondition{Field: "hasFocusUUIDs", Change: RelationshipAdded}},
+			existing: organisation("Label", source(map[string]interface{}{"hasFocusUUIDs": []interface{}{"focus-1", "focus-2"}})),
+			updated:  organisation("Label", source(map[string]interface{}{"hasFocusUUIDs": []interface{}{"focus-1"}})),
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := NewAnnotationsRules(test.rule)
+			assert.NoError(t, err)
+			changelog, err := diffConcepts(test.existing, test.updated)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, rules.AnnotationsChange(test.existing, test.updated, changelog))
+		})
+	}
+}
+
+func TestLoadAnnotationsRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"name":"labels","paths":["/prefLabel"]}]}`), 0600))
+
+	rules, err := LoadAnnotationsRules(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []AnnotationsRule{{Name: "labels", Paths: []string{"/prefLabel"}}}, rules.Rules())
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"name":"labels","scope":"everywhere","paths":["/prefLabel"]}]}`), 0600))
+	assert.EqualError(t, rules.Reload(), `invalid annotations rules file `+path+`: rule labels has an unknown scope "everywhere"`)
+	assert.Equal(t, []AnnotationsRule{{Name: "labels", Paths: []string{"/prefLabel"}}}, rules.Rules(), "Invalid rules should not replace the current ones")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"name":"focus","relationship":{"field":"hasFocusUUIDs","change":"added"}}]}`), 0600))
+	assert.NoError(t, rules.Reload())
+	assert.Equal(t, []AnnotationsRule{{Name: "focus", Relationship: &RelationshipCondition{Field: "hasFocusUUIDs", Change: RelationshipAdded}}}, rules.Rules())
+
+	_, err = NewAnnotationsRules(AnnotationsRule{Name: "empty"})
+	assert.EqualError(t, err, "rule empty has neither paths nor a relationship")
+}
@@ -0,0 +1,193 @@
+package concepts
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+)
+
+type bulkWriteJob struct {
+	line int
+	data []byte
+}
+
+// bulkWriteResult is streamed back for every line of a bulk request
+type bulkWriteResult struct {
+	Line    int         `json:"line"`
+	UUID    string      `json:"uuid,omitempty"`
+	Status  int         `json:"status"`
+	Changes interface{} `json:"changes,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// BulkWriteConcepts reads newline delimited aggregated concepts from the request body and writes each of them.
+// The result of every write is streamed back as newline delimited JSON, in the order in which the writes complete.
+func (h *ConceptsHandler) BulkWriteConcepts(w http.ResponseWriter, r *http.Request) {
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Set("X-Request-Id", transID)
+
+	if h.BulkMaxBodySize > 0 {
+		if r.ContentLength > h.BulkMaxBodySize {
+			w.Header().Add("Content-Type", "application/json")
+			writeJSONError(w, bodyTooLargeMessage(h.BulkMaxBodySize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.BulkMaxBodySize)
+	}
+
+	// Under HTTP/1.1 the request body is closed once the response is flushed, so the results can only be streamed while
+	// the body is being read if the connection allows it. Otherwise the body, bounded as above, is spooled to a
+	// temporary file before responding.
+	var body io.Reader = r.Body
+	if err := enableFullDuplex(w, r); err != nil {
+		spooled, err := spoolBody(r.Body)
+		if err != nil {
+			msg, statusCode := bulkReadError(err)
+			w.Header().Add("Content-Type", "application/json")
+			writeJSONError(w, msg, statusCode)
+			return
+		}
+		defer func() {
+			spooled.Close()
+			os.Remove(spooled.Name())
+		}()
+		body = spooled
+	}
+	w.Header().Add("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	jobs := make(chan bulkWriteJob)
+	results := make(chan bulkWriteResult)
+
+	var workers sync.WaitGroup
+	for i := 0; i < h.bulkConcurrency(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				results <- h.bulkWrite(r.Context(), job, transID)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		for result := range results {
+			if err := enc.Encode(result); err != nil {
+				// the client has gone away, keep draining so the workers can finish
+				continue
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}()
+
+	reader := bufio.NewReader(body)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			jobs <- bulkWriteJob{line: line, data: data}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			msg, statusCode := bulkReadError(err)
+			results <- bulkWriteResult{Line: line, Status: statusCode, Error: msg}
+			break
+		}
+	}
+
+	close(jobs)
+	workers.Wait()
+	close(results)
+	<-done
+}
+
+func (h *ConceptsHandler) bulkWrite(ctx context.Context, job bulkWriteJob, transID string) bulkWriteResult {
+	inst, docUUID, err := h.ConceptsService.DecodeJSON(json.NewDecoder(bytes.NewReader(job.data)))
+	if err != nil {
+		return bulkWriteResult{Line: job.line, Status: http.StatusBadRequest, Error: err.Error()}
+	}
+
+	ctx, cancel := withTimeout(ctx, h.WriteTimeout)
+	defer cancel()
+	changes, err := h.ConceptsService.Write(ctx, inst, transID, WriteOptions{})
+	if err != nil {
+		statusCode, msg := writeErrorStatus(err)
+		return bulkWriteResult{Line: job.line, UUID: docUUID, Status: statusCode, Error: msg}
+	}
+	return bulkWriteResult{Line: job.line, UUID: docUUID, Status: http.StatusOK, Changes: changes}
+}
+
+func (h *ConceptsHandler) bulkConcurrency() int {
+	if h.BulkConcurrency < 1 {
+		return 1
+	}
+	return h.BulkConcurrency
+}
+
+// bulkReadError returns the message and status of a failure to read the body of a bulk request
+func bulkReadError(err error) (string, int) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return bodyTooLargeMessage(tooLarge.Limit), http.StatusRequestEntityTooLarge
+	}
+	return err.Error(), http.StatusBadRequest
+}
+
+func bodyTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("request body is larger than %d bytes", limit)
+}
+
+type responseControllerKey struct{}
+
+// withResponseController keeps a controller of the response writer it is given in the request context, so that
+// handlers behind middleware wrapping the writer without an Unwrap method can still control the connection
+func withResponseController(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), responseControllerKey{}, http.NewResponseController(w))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// enableFullDuplex lets the handler write the response while still reading the request body, through the writer it
+// was given or else the one kept by withResponseController
+func enableFullDuplex(w http.ResponseWriter, r *http.Request) error {
+	err := http.NewResponseController(w).EnableFullDuplex()
+	if rc, ok := r.Context().Value(responseControllerKey{}).(*http.ResponseController); ok && err != nil {
+		err = rc.EnableFullDuplex()
+	}
+	return err
+}
+
+// spoolBody copies the body to a temporary file read from the start, so that large bodies are not held in memory.
+// The caller removes the file once done with it.
+func spoolBody(body io.Reader) (*os.File, error) {
+	file, err := os.CreateTemp("", "bulk-concepts-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(file, body); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,126 @@
+package concepts
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/r3labs/diff/v3"
+)
+
+// Change log operations, named after their JSON Patch counterparts
+const (
+	ChangeLogAdd     = "add"
+	ChangeLogRemove  = "remove"
+	ChangeLogReplace = "replace"
+)
+
+var changeLogOps = map[string]string{
+	diff.CREATE: ChangeLogAdd,
+	diff.DELETE: ChangeLogRemove,
+	diff.UPDATE: ChangeLogReplace,
+}
+
+// ChangeLogEntry is a single change of a concept. Path is a JSON Pointer into the canonical concept or, when SourceUUID
+// is set, into the source representation with that uuid, the empty path standing for the whole source representation.
+type ChangeLogEntry struct {
+	Op         string      `json:"op"`
+	Path       string      `json:"path"`
+	From       interface{} `json:"from"`
+	To         interface{} `json:"to"`
+	SourceUUID string      `json:"sourceUUID,omitempty"`
+}
+
+// ChangeLog lists the changes of the canonical concept first, then those of its source representations
+type ChangeLog []ChangeLogEntry
+
+// diffConcepts returns the changes between two mappified concepts, matching their source representations by uuid so that
+// reordering them is not reported as a change.
+func diffConcepts(existing, updated map[string]interface{}) (ChangeLog, error) {
+	existingCanonical, existingSources := splitSourceRepresentations(existing)
+	updatedCanonical, updatedSources := splitSourceRepresentations(updated)
+
+	canonicalChanges, err := diff.Diff(existingCanonical, updatedCanonical)
+	if err != nil {
+		return nil, err
+	}
+	changelog := changeLogEntries(canonicalChanges, "")
+
+	updatedByUUID := map[string]map[string]interface{}{}
+	for _, source := range updatedSources {
+		updatedByUUID[sourceUUID(source)] = source
+	}
+	existingUUIDs := map[string]bool{}
+	for _, source := range existingSources {
+		uuid := sourceUUID(source)
+		existingUUIDs[uuid] = true
+		updatedSource, ok := updatedByUUID[uuid]
+		if !ok {
+			changelog = append(changelog, ChangeLogEntry{Op: ChangeLogRemove, Path: "", From: source, SourceUUID: uuid})
+			continue
+		}
+		sourceChanges, err := diff.Diff(source, updatedSource)
+		if err != nil {
+			return nil, err
+		}
+		changelog = append(changelog, changeLogEntries(sourceChanges, uuid)...)
+	}
+	for _, source := range updatedSources {
+		if uuid := sourceUUID(source); !existingUUIDs[uuid] {
+			changelog = append(changelog, ChangeLogEntry{Op: ChangeLogAdd, Path: "", To: source, SourceUUID: uuid})
+		}
+	}
+	return changelog, nil
+}
+
+// changeLogEntries converts the changes, sorted by path, attributing them to the source representation if any
+func changeLogEntries(changes diff.Changelog, sourceUUID string) ChangeLog {
+	entries := make(ChangeLog, 0, len(changes))
+	for _, change := range changes {
+		entries = append(entries, ChangeLogEntry{
+			Op:         changeLogOps[change.Type],
+			Path:       jsonPointer(change.Path),
+			From:       change.From,
+			To:         change.To,
+			SourceUUID: sourceUUID,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// splitSourceRepresentations returns a copy of the mappified concept without its source representations, and them
+func splitSourceRepresentations(concept map[string]interface{}) (map[string]interface{}, []map[string]interface{}) {
+	canonical := make(map[string]interface{}, len(concept))
+	for key, value := range concept {
+		canonical[key] = value
+	}
+	values, _ := canonical["sourceRepresentations"].([]interface{})
+	delete(canonical, "sourceRepresentations")
+	sources := make([]map[string]interface{}, 0, len(values))
+	for _, value := range values {
+		if source, ok := value.(map[string]interface{}); ok {
+			sources = append(sources, source)
+		}
+	}
+	return canonical, sources
+}
+
+func sourceUUID(source map[string]interface{}) string {
+	uuid, _ := source["uuid"].(string)
+	return uuid
+}
+
+// jsonPointerEscaper escapes the reference tokens of a JSON Pointer
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPointer returns the RFC 6901 JSON Pointer of the path
+func jsonPointer(path []string) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteString("/")
+		b.WriteString(jsonPointerEscaper.Replace(token))
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package concepts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConcepts(t *testing.T) {
+	existing := map[string]interface{}{
+		"prefLabel": "Old Label",
+		"aliases":   []interface{}{"one", "two"},
+		"sourceRepresentations": []interface{}{
+			map[string]interface{}{"uuid": "uuid-1", "prefLabel": "First"},
+			map[string]interface{}{"uuid": "uuid-2", "prefLabel": "Second"},
+			map[string]interface{}{"uuid": "uuid-3", "prefLabel": "Third"},
+		},
+	}
+	updated := map[string]interface{}{
+		"prefLabel": "New Label",
+		"aliases":   []interface{}{"one"},
+		"a/b~c":     "escaped",
+		"sourceRepresentations": []interface{}{
+			map[string]interface{}{"uuid": "uuid-4", "prefLabel": "Fourth"},
+			map[string]interface{}{"uuid": "uuid-2", "prefLabel": "Second, renamed"},
+			map[string]interface{}{"uuid": "uuid-1", "prefLabel": "First"},
+		},
+	}
+
+	changelog, err := diffConcepts(existing, updated)
+	assert.NoError(t, err)
+	assert.Equal(t, ChangeLog{
+		{Op: ChangeLogRemove, Path: "/aliases/1", From: "two"},
+		{Op: ChangeLogAdd, Path: "/a~1b~0c", To: "escaped"},
+		{Op: ChangeLogReplace, Path: "/prefLabel", From: "Old Label", To: "New Label"},
+		{Op: ChangeLogReplace, Path: "/prefLabel", From: "Second", To: "Second, renamed", SourceUUID: "uuid-2"},
+		{Op: ChangeLogRemove, Path: "", From: map[string]interface{}{"uuid": "uuid-3", "prefLabel": "Third"}, SourceUUID: "uuid-3"},
+		{Op: ChangeLogAdd, Path: "", To: map[string]interface{}{"uuid": "uuid-4", "prefLabel": "Fourth"}, SourceUUID: "uuid-4"},
+	}, changelog, "Reordered source representations should be matched by uuid")
+}
+
+func TestDiffConceptsNestedArrayIndices(t *testing.T) {
+	existing := map[string]interface{}{
+		"naicsIndustryClassifications": []interface{}{
+			map[string]interface{}{"uuid": "naics-1", "rank": 1},
+			map[string]interface{}{"uuid": "naics-2", "rank": 2},
+		},
+		"sourceRepresentations": []interface{}{
+			map[string]interface{}{
+				"uuid":            "uuid-1",
+				"relatedUUIDs":    []interface{}{"related-1", "related-2"},
+				"membershipRoles": []interface{}{map[string]interface{}{"membershipRoleUUID": "role-1", "inceptionDate": "2000-01-01"}},
+			},
+		},
+	}
+	updated := map[string]interface{}{
+		"naicsIndustryClassifications": []interface{}{
+			map[string]interface{}{"uuid": "naics-1", "rank": 1},
+			map[string]interface{}{"uuid": "naics-2", "rank": 3},
+		},
+		"sourceRepresentations": []interface{}{
+			map[string]interface{}{
+				"uuid":            "uuid-1",
+				"relatedUUIDs":    []interface{}{"related-1", "related-3"},
+				"membershipRoles": []interface{}{map[string]interface{}{"membershipRoleUUID": "role-1", "inceptionDate": "2001-01-01"}},
+			},
+		},
+	}
+
+	changelog, err := diffConcepts(existing, updated)
+	assert.NoError(t, err)
+	assert.Equal(t, ChangeLog{
+		{Op: ChangeLogReplace, Path: "/naicsIndustryClassifications/1/rank", From: 2, To: 3},
+		{Op: ChangeLogReplace, Path: "/membershipRoles/0/inceptionDate", From: "2000-01-01", To: "2001-01-01", SourceUUID: "uuid-1"},
+		{Op: ChangeLogReplace, Path: "/relatedUUIDs/1", From: "related-2", To: "related-3", SourceUUID: "uuid-1"},
+	}, changelog, "Changes within arrays should be reported with the index of the element in the path")
+}
+
+func TestDiffConceptsUnchangedReorder(t *testing.T) {
+	existing := map[string]interface{}{
+		"aliases": []interface{}{"one", "two"},
+		"naicsIndustryClassifications": []interface{}{
+			map[string]interface{}{"uuid": "naics-1", "rank": 1},
+			map[string]interface{}{"uuid": "naics-2", "rank": 2},
+		},
+		"sourceRepresentations": []interface{}{
+			map[string]interface{}{"uuid": "uuid-1", "relatedUUIDs": []interface{}{"related-1", "related-2"}},
+			map[string]interface{}{"uuid": "uuid-2"},
+		},
+	}
+	updated := map[string]interface{}{
+		"aliases": []interface{}{"two", "one"},
+		"naicsIndustryClassifications": []interface{}{
+			map[string]interface{}{"uuid": "naics-2", "rank": 2},
+			map[string]interface{}{"uuid": "naics-1", "rank": 1},
+		},
+		"sourceRepresentations": []interface{}{
+			map[string]interface{}{"uuid": "uuid-2"},
+			map[string]interface{}{"uuid": "uuid-1", "relatedUUIDs": []interface{}{"related-2", "related-1"}},
+		},
+	}
+
+	changelog, err := diffConcepts(existing, updated)
+	assert.NoError(t, err)
+	assert.Empty(t, changelog, "Reordering arrays without changing their elements should not be reported as a change")
+}
@@ -0,0 +1,239 @@
+package concepts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+)
+
+const (
+	defaultChangesPollInterval = time.Second
+	// defaultChangesSettleLag is how long after being written outbox entries are read again by the change feed,
+	// covering the default write and delete timeouts and some clock skew between replicas
+	defaultChangesSettleLag = 35 * time.Second
+	changesBatchSize        = 100
+	// changesKeepAliveInterval is how often a comment is sent on an idle stream, so that proxies do not close it
+	changesKeepAliveInterval = 15 * time.Second
+)
+
+// StreamChanges streams the concept change events as Server-Sent Events, starting after the Last-Event-ID if any, or
+// from now on otherwise. The conceptType and eventType query parameters are comma separated lists filtering the events.
+func (h *ConceptsHandler) StreamChanges(w http.ResponseWriter, r *http.Request) {
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Set("X-Request-Id", transID)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Add("Content-Type", "application/json")
+		writeJSONError(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("lastEventId")
+	}
+	filter := eventFilter{
+		conceptTypes: splitList(r.URL.Query().Get("conceptType")),
+		eventTypes:   splitList(r.URL.Query().Get("eventType")),
+	}
+
+	settleLag := h.ChangesSettleLag
+	if settleLag <= 0 {
+		settleLag = defaultChangesSettleLag
+	}
+	feed := newChangeFeed(cursor, settleLag)
+
+	// check that the feed is available before committing to a streaming response
+	entries, err := h.pollChanges(r, feed)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		if errors.Is(err, ErrOutboxDisabled) {
+			writeJSONError(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	pollInterval := h.ChangesPollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultChangesPollInterval
+	}
+	lastSent := time.Now()
+	for {
+		for _, entry := range entries {
+			if !filter.matches(entry.Event) {
+				continue
+			}
+			if err := writeChangeEvent(w, entry); err != nil {
+				return
+			}
+			lastSent = time.Now()
+		}
+		if len(entries) > 0 {
+			flusher.Flush()
+		}
+
+		if time.Since(lastSent) > changesKeepAliveInterval {
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastSent = time.Now()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(pollInterval):
+		}
+
+		entries, err = h.pollChanges(r, feed)
+		if r.Context().Err() != nil {
+			return
+		}
+		if err != nil {
+			// the client resumes from the last event it received when it reconnects
+			return
+		}
+	}
+}
+
+func (h *ConceptsHandler) readChanges(r *http.Request, cursor string) ([]OutboxEntry, string, error) {
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	return h.ConceptsService.ReadChanges(ctx, cursor, changesBatchSize)
+}
+
+// changeFeed follows the outbox for a stream. An entry can commit after entries with later ids, so the entries written
+// within the settle lag are read again on every poll, the ones already sent being skipped.
+type changeFeed struct {
+	settleLag time.Duration
+	// settled is the id up to which every entry was read
+	settled string
+	// sent holds the ids after settled of the entries already read
+	sent map[string]bool
+}
+
+// newChangeFeed returns a feed of the entries written from now on, or of the entries after the one with the given id.
+// A resumed feed reads again from the settle lag before the id so as not to miss the entries committed after it, the
+// client getting the entries it already received within the lag again.
+func newChangeFeed(after string, settleLag time.Duration) *changeFeed {
+	feed := &changeFeed{settleLag: settleLag, settled: after, sent: map[string]bool{}}
+	if after == "" {
+		feed.settled = outboxCursorAt(time.Now())
+	} else if t, ok := outboxTime(after); ok {
+		feed.settled = outboxCursorAt(t.Add(-settleLag))
+	}
+	return feed
+}
+
+// pollChanges returns the entries of the feed not sent yet, reading every entry written since the settled id
+func (h *ConceptsHandler) pollChanges(r *http.Request, feed *changeFeed) ([]OutboxEntry, error) {
+	settleAt := outboxCursorAt(time.Now().Add(-feed.settleLag))
+	var unsent []OutboxEntry
+	after := feed.settled
+	for {
+		entries, last, err := h.readChanges(r, after)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !feed.sent[entry.ID] {
+				feed.sent[entry.ID] = true
+				unsent = append(unsent, entry)
+			}
+		}
+		if last == after {
+			break
+		}
+		if last <= settleAt {
+			feed.settled = last
+		}
+		after = last
+	}
+	for id := range feed.sent {
+		if id <= feed.settled {
+			delete(feed.sent, id)
+		}
+	}
+	return unsent, nil
+}
+
+func writeChangeEvent(w http.ResponseWriter, entry OutboxEntry) error {
+	data, err := json.Marshal(entry.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", entry.ID, eventType(entry.Event), data)
+	return err
+}
+
+// eventFilter selects events by concept type and event type, an empty list matching any type, and optionally only the
+// events of changes that can affect annotations
+type eventFilter struct {
+	conceptTypes          []string
+	eventTypes            []string
+	annotationsChangeOnly bool
+}
+
+func (f eventFilter) matches(event Event) bool {
+	return matchesAny(f.conceptTypes, event.ConceptType) && matchesAny(f.eventTypes, eventType(event)) &&
+		(!f.annotationsChangeOnly || annotationsChange(event))
+}
+
+func matchesAny(values []string, value string) bool {
+	return len(values) == 0 || slices.Contains(values, value)
+}
+
+// eventType returns the type of the event details, which are decoded as a map when read back from the outbox
+func eventType(event Event) string {
+	switch details := event.EventDetails.(type) {
+	case ConceptEvent:
+		return details.Type
+	case ConcordanceEvent:
+		return details.Type
+	case ConceptChangeLogEvent:
+		return details.Type
+	case map[string]interface{}:
+		t, _ := details["eventType"].(string)
+		return t
+	}
+	return ""
+}
+
+// splitList splits a comma separated query parameter
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// annotationsChange tells whether the event is the changelog of a change that can affect annotations, its details being
+// decoded as a map when read back from the outbox
+func annotationsChange(event Event) bool {
+	switch details := event.EventDetails.(type) {
+	case ConceptChangeLogEvent:
+		return details.AnnotationsChange
+	case map[string]interface{}:
+		changed, _ := details["annotationsChange"].(bool)
+		return changed
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package concepts
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// CloudEventContentType is the content type of a single event in the structured mode of the CloudEvents JSON format
+	CloudEventContentType = "application/cloudevents+json"
+	// CloudEventsBatchContentType is the content type of a JSON array of CloudEvents
+	CloudEventsBatchContentType = "application/cloudevents-batch+json"
+	cloudEventsSpecVersion      = "1.0"
+	cloudEventsSource           = "/concepts-rw-neo4j"
+)
+
+// cloudEventTypes maps the event types to the types of their CloudEvents
+var cloudEventTypes = map[string]string{
+	UpdatedEvent:   "com.ft.concept.updated",
+	AddedEvent:     "com.ft.concordance.added",
+	RemovedEvent:   "com.ft.concordance.removed",
+	ChangeLogEvent: "com.ft.concept.changelog",
+	DeletedEvent:   "com.ft.concept.deleted",
+}
+
+// CloudEvent is the CloudEvents 1.0 JSON representation of an Event, the subject being the uuid of the concept
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// ConceptEventData holds what the data of every CloudEvent has in common
+type ConceptEventData struct {
+	ConceptType   string `json:"conceptType"`
+	ConceptUUID   string `json:"conceptUUID"`
+	AggregateHash string `json:"aggregateHash"`
+	TransactionID string `json:"transactionID"`
+}
+
+// ConceptUpdatedData is the data of a com.ft.concept.updated CloudEvent
+type ConceptUpdatedData struct {
+	ConceptEventData
+}
+
+// ConceptDeletedData is the data of a com.ft.concept.deleted CloudEvent, the aggregate hash being the last one of the
+// canonical concept
+type ConceptDeletedData struct {
+	ConceptEventData
+}
+
+// ConcordanceAddedData is the data of a com.ft.concordance.added CloudEvent, the concept with OldID now being a source
+// of the canonical concept with NewID
+type ConcordanceAddedData struct {
+	ConceptEventData
+	OldID string `json:"oldID"`
+	NewID string `json:"newID"`
+}
+
+// ConcordanceRemovedData is the data of a com.ft.concordance.removed CloudEvent, the concept with OldID no longer
+// being a source of the canonical concept with NewID
+type ConcordanceRemovedData struct {
+	ConceptEventData
+	OldID string `json:"oldID"`
+	NewID string `json:"newID"`
+}
+
+// ConceptChangeLogData is the data of a com.ft.concept.changelog CloudEvent
+type ConceptChangeLogData struct {
+	ConceptEventData
+	AnnotationsChange bool      `json:"annotationsChange"`
+	ChangeLog         ChangeLog `json:"changelog"`
+}
+
+// NewCloudEvent returns the CloudEvent of the event, with the given id and time.
+func NewCloudEvent(event Event, id string, t time.Time) (CloudEvent, error) {
+	data, err := cloudEventData(event)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id,
+		Source:          cloudEventsSource,
+		Type:            cloudEventTypes[eventType(event)],
+		Subject:         event.ConceptUUID,
+		Time:            t.UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}, nil
+}
+
+// cloudEventData returns the typed data of the event, whose details are decoded as a map when read back from the outbox
+func cloudEventData(event Event) (interface{}, error) {
+	details := event.EventDetails
+	if m, ok := details.(map[string]interface{}); ok {
+		var err error
+		if details, err = decodeEventDetails(m); err != nil {
+			return nil, err
+		}
+	}
+
+	common := ConceptEventData{
+		ConceptType:   event.ConceptType,
+		ConceptUUID:   event.ConceptUUID,
+		AggregateHash: event.AggregateHash,
+		TransactionID: event.TransactionID,
+	}
+	switch d := details.(type) {
+	case ConceptEvent:
+		if d.Type == DeletedEvent {
+			return ConceptDeletedData{ConceptEventData: common}, nil
+		}
+		return ConceptUpdatedData{ConceptEventData: common}, nil
+	case ConcordanceEvent:
+		if d.Type == RemovedEvent {
+			return ConcordanceRemovedData{ConceptEventData: common, OldID: d.OldID, NewID: d.NewID}, nil
+		}
+		return ConcordanceAddedData{ConceptEventData: common, OldID: d.OldID, NewID: d.NewID}, nil
+	case ConceptChangeLogEvent:
+		return ConceptChangeLogData{ConceptEventData: common, AnnotationsChange: d.AnnotationsChange, ChangeLog: d.ChangeLog}, nil
+	}
+	return nil, fmt.Errorf("unsupported event details %T", details)
+}
+
+func decodeEventDetails(m map[string]interface{}) (interface{}, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	eventType, _ := m["eventType"].(string)
+	switch eventType {
+	case UpdatedEvent, DeletedEvent:
+		var details ConceptEvent
+		err = json.Unmarshal(body, &details)
+		return details, err
+	case AddedEvent, RemovedEvent:
+		var details ConcordanceEvent
+		err = json.Unmarshal(body, &details)
+		return details, err
+	case ChangeLogEvent:
+		var details ConceptChangeLogEvent
+		err = json.Unmarshal(body, &details)
+		return details, err
+	}
+	return nil, fmt.Errorf("unsupported event type %q", eventType)
+}
+
+// cloudEventsBatch returns the CloudEvents of the events of a single write, identified by random ids as they have no
+// outbox id yet and transaction IDs are reused by clients across requests.
+func cloudEventsBatch(events []Event, t time.Time) ([]CloudEvent, error) {
+	batch := make([]CloudEvent, 0, len(events))
+	for _, event := range events {
+		id, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		ce, err := NewCloudEvent(event, id, t)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, ce)
+	}
+	return batch, nil
+}
+
+// EventFormat is the representation of the events delivered by the event sinks
+type EventFormat string
+
+const (
+	// NativeEventFormat is the Event JSON, as returned by writes
+	NativeEventFormat EventFormat = "native"
+	// CloudEventsFormat is the structured mode of the CloudEvents 1.0 JSON format
+	CloudEventsFormat EventFormat = "cloudevents"
+)
+
+func ParseEventFormat(value string) (EventFormat, error) {
+	switch f := EventFormat(value); f {
+	case NativeEventFormat, CloudEventsFormat:
+		return f, nil
+	case "":
+		return NativeEventFormat, nil
+	}
+	return "", fmt.Errorf("unknown event format %q", value)
+}
+
+// ContentType returns the content type of an encoded event.
+func (f EventFormat) ContentType() string {
+	if f == CloudEventsFormat {
+		return CloudEventContentType
+	}
+	return "application/json"
+}
+
+// Encode returns the JSON of the outbox entry in this format.
+func (f EventFormat) Encode(entry OutboxEntry) ([]byte, error) {
+	if f != CloudEventsFormat {
+		return json.Marshal(entry.Event)
+	}
+	ce, err := NewCloudEvent(entry.Event, entry.ID, entry.WrittenAt)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ce)
+}
+
+// acceptsCloudEvents reports whether the client asked for the events of a write as a CloudEvents batch
+func acceptsCloudEvents(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == CloudEventsBatchContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCloudEvents responds with the events as a CloudEvents batch
+func writeCloudEvents(w http.ResponseWriter, events []Event, uuids ...string) {
+	batch, err := cloudEventsBatch(events, time.Now())
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError, uuids...)
+		return
+	}
+	w.Header().Set("Content-Type", CloudEventsBatchContentType)
+	writeJSON(w, http.StatusOK, batch)
+}
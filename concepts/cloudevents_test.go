@@ -0,0 +1,113 @@
+package concepts
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCloudEvent(t *testing.T) {
+	common := ConceptEventData{ConceptType: "Brand", ConceptUUID: "uuid-1", AggregateHash: "123", TransactionID: "tid_1"}
+	changelog := ChangeLog{{Op: ChangeLogReplace, Path: "/prefLabel", From: "Old Label", To: "New Label", SourceUUID: "uuid-2"}}
+	tests := []struct {
+		name    string
+		details interface{}
+		ceType  string
+		data    interface{}
+	}{
+		{
+			name:    "ConceptUpdated",
+			details: ConceptEvent{Type: UpdatedEvent},
+			ceType:  "com.ft.concept.updated",
+			data:    ConceptUpdatedData{ConceptEventData: common},
+		},
+		{
+			name:    "ConceptDeleted",
+			details: ConceptEvent{Type: DeletedEvent},
+			ceType:  "com.ft.concept.deleted",
+			data:    ConceptDeletedData{ConceptEventData: common},
+		},
+		{
+			name:    "ConcordanceAdded",
+			details: ConcordanceEvent{Type: AddedEvent, OldID: "uuid-1", NewID: "uuid-2"},
+			ceType:  "com.ft.concordance.added",
+			data:    ConcordanceAddedData{ConceptEventData: common, OldID: "uuid-1", NewID: "uuid-2"},
+		},
+		{
+			name:    "ConcordanceRemoved",
+			details: ConcordanceEvent{Type: RemovedEvent, OldID: "uuid-1", NewID: "uuid-2"},
+			ceType:  "com.ft.concordance.removed",
+			data:    ConcordanceRemovedData{ConceptEventData: common, OldID: "uuid-1", NewID: "uuid-2"},
+		},
+		{
+			name:    "ConceptChangeLog",
+			details: ConceptChangeLogEvent{Type: ChangeLogEvent, AnnotationsChange: true, ChangeLog: changelog},
+			ceType:  "com.ft.concept.changelog",
+			data:    ConceptChangeLogData{ConceptEventData: common, AnnotationsChange: true, ChangeLog: changelog},
+		},
+	}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := Event{ConceptType: "Brand", ConceptUUID: "uuid-1", AggregateHash: "123", TransactionID: "tid_1", EventDetails: test.details}
+			expected := CloudEvent{
+				SpecVersion:     "1.0",
+				ID:              "id-1",
+				Source:          "/concepts-rw-neo4j",
+				Type:            test.ceType,
+				Subject:         "uuid-1",
+				Time:            now,
+				DataContentType: "application/json",
+				Data:            test.data,
+			}
+			ce, err := NewCloudEvent(event, "id-1", now)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, ce)
+
+			// events read back from the outbox have their details decoded as a map
+			body, _ := json.Marshal(event)
+			var decoded Event
+			assert.NoError(t, json.Unmarshal(body, &decoded))
+			ce, err = NewCloudEvent(decoded, "id-1", now)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, ce)
+		})
+	}
+
+	_, err := NewCloudEvent(Event{EventDetails: map[string]interface{}{"eventType": "UNKNOWN"}}, "id-1", now)
+	assert.EqualError(t, err, `unsupported event type "UNKNOWN"`)
+}
+
+func TestEventFormatEncode(t *testing.T) {
+	written := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := OutboxEntry{
+		ID:        "00000000000000000042",
+		Event:     Event{ConceptType: "Brand", ConceptUUID: "uuid-1", TransactionID: "tid_1", EventDetails: ConceptEvent{Type: UpdatedEvent}},
+		WrittenAt: written,
+	}
+
+	body, err := NativeEventFormat.Encode(entry)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"Brand","uuid":"uuid-1","aggregateHash":"","transactionID":"tid_1","eventDetails":{"eventType":"CONCEPT_UPDATED"}}`, string(body))
+
+	body, err = CloudEventsFormat.Encode(entry)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"specversion":"1.0",
+		"id":"`+entry.ID+`",
+		"source":"/concepts-rw-neo4j",
+		"type":"com.ft.concept.updated",
+		"subject":"uuid-1",
+		"time":"2026-01-02T03:04:05Z",
+		"datacontenttype":"application/json",
+		"data":{"conceptType":"Brand","conceptUUID":"uuid-1","aggregateHash":"","transactionID":"tid_1"}
+	}`, string(body))
+
+	format, err := ParseEventFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, NativeEventFormat, format)
+	_, err = ParseEventFormat("avro")
+	assert.EqualError(t, err, `unknown event format "avro"`)
+}
@@ -1,39 +1,120 @@
 package concepts
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 )
 
 type mockConceptService struct {
-	write      func(thing interface{}, transID string) (interface{}, error)
-	read       func(uuid string, transID string) (interface{}, bool, error)
-	delete     func(uuid string, transID string) ([]string, error)
-	decodeJSON func(*json.Decoder) (interface{}, string, error)
-	check      func() error
+	write              func(thing interface{}, transID string, opts WriteOptions) (interface{}, error)
+	preview            func(thing interface{}, transID string, opts WriteOptions) (interface{}, error)
+	read               func(uuid string, transID string) (interface{}, bool, error)
+	lookupByAuthority  func(authority, authorityValue, transID string) (interface{}, bool, error)
+	lookupByIdentifier func(identifier, value, transID string) (interface{}, bool, error)
+	resolvePrefUUID    func(uuid, transID string) (string, bool, error)
+	list               func(opts ListOptions, transID string) (ConceptList, error)
+	stats              func(types []string, transID string) (map[string]TypeStats, error)
+	delete             func(uuid string, transID string) (ConceptChanges, error)
+	unconcord          func(prefUUID string, sourceUUIDs []string, transID string, opts WriteOptions) (ConceptChanges, error)
+	merge              func(prefUUID, mergedUUID string, transID string, opts MergeOptions) (ConceptChanges, error)
+	readConcordance    func(uuid string, transID string) (ConcordanceGraph, bool, error)
+	readChanges        func(after string, limit int) ([]OutboxEntry, string, error)
+	decodeJSON         func(*json.Decoder) (interface{}, string, error)
+	check              func() error
 }
 
-func (mcs *mockConceptService) Delete(uuid string, transID string) ([]string, error) {
+func (mcs *mockConceptService) Delete(_ context.Context, uuid string, transID string) (ConceptChanges, error) {
 	if mcs.delete != nil {
 		return mcs.delete(uuid, transID)
 	}
-	return nil, errors.New("not implemented")
+	return ConceptChanges{}, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) Unconcord(_ context.Context, prefUUID string, sourceUUIDs []string, transID string, opts WriteOptions) (ConceptChanges, error) {
+	if mcs.unconcord != nil {
+		return mcs.unconcord(prefUUID, sourceUUIDs, transID, opts)
+	}
+	return ConceptChanges{}, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) Merge(_ context.Context, prefUUID, mergedUUID string, transID string, opts MergeOptions) (ConceptChanges, error) {
+	if mcs.merge != nil {
+		return mcs.merge(prefUUID, mergedUUID, transID, opts)
+	}
+	return ConceptChanges{}, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) ReadConcordance(_ context.Context, uuid string, transID string) (ConcordanceGraph, bool, error) {
+	if mcs.readConcordance != nil {
+		return mcs.readConcordance(uuid, transID)
+	}
+	return ConcordanceGraph{}, false, errors.New("not implemented")
 }
 
-func (mcs *mockConceptService) Write(thing interface{}, transID string) (interface{}, error) {
+func (mcs *mockConceptService) Write(_ context.Context, thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 	if mcs.write != nil {
-		return mcs.write(thing, transID)
+		return mcs.write(thing, transID, opts)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) Preview(_ context.Context, thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+	if mcs.preview != nil {
+		return mcs.preview(thing, transID, opts)
 	}
 	return nil, errors.New("not implemented")
 }
 
-func (mcs *mockConceptService) Read(uuid string, transID string) (interface{}, bool, error) {
+func (mcs *mockConceptService) Read(_ context.Context, uuid string, transID string) (interface{}, bool, error) {
 	if mcs.read != nil {
 		return mcs.read(uuid, transID)
 	}
 	return nil, false, errors.New("not implemented")
 }
 
+func (mcs *mockConceptService) LookupByAuthority(_ context.Context, authority, authorityValue, transID string) (interface{}, bool, error) {
+	if mcs.lookupByAuthority != nil {
+		return mcs.lookupByAuthority(authority, authorityValue, transID)
+	}
+	return nil, false, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) LookupByIdentifier(_ context.Context, identifier, value, transID string) (interface{}, bool, error) {
+	if mcs.lookupByIdentifier != nil {
+		return mcs.lookupByIdentifier(identifier, value, transID)
+	}
+	return nil, false, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) ResolvePrefUUID(_ context.Context, uuid, transID string) (string, bool, error) {
+	if mcs.resolvePrefUUID != nil {
+		return mcs.resolvePrefUUID(uuid, transID)
+	}
+	return "", false, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) List(_ context.Context, opts ListOptions, transID string) (ConceptList, error) {
+	if mcs.list != nil {
+		return mcs.list(opts, transID)
+	}
+	return ConceptList{}, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) Stats(_ context.Context, types []string, transID string) (map[string]TypeStats, error) {
+	if mcs.stats != nil {
+		return mcs.stats(types, transID)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (mcs *mockConceptService) ReadChanges(_ context.Context, after string, limit int) ([]OutboxEntry, string, error) {
+	if mcs.readChanges != nil {
+		return mcs.readChanges(after, limit)
+	}
+	return nil, after, errors.New("not implemented")
+}
+
 func (mcs *mockConceptService) DecodeJSON(d *json.Decoder) (interface{}, string, error) {
 	if mcs.decodeJSON != nil {
 		return mcs.decodeJSON(d)
@@ -41,7 +122,7 @@ func (mcs *mockConceptService) DecodeJSON(d *json.Decoder) (interface{}, string,
 	return nil, "", errors.New("not implemented")
 }
 
-func (mcs *mockConceptService) Check() error {
+func (mcs *mockConceptService) Check(_ context.Context) error {
 	if mcs.check != nil {
 		return mcs.check()
 	}
@@ -1,20 +1,20 @@
 package concepts
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
-
-	"github.com/r3labs/diff/v3"
-	"golang.org/x/exp/slices"
+	"time"
 
 	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/mitchellh/hashstructure"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 
 	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
 	"github.com/Financial-Times/cm-graph-ontology/v2/neo4j"
@@ -26,6 +26,7 @@ const (
 	AddedEvent     = "CONCORDANCE_ADDED"
 	RemovedEvent   = "CONCORDANCE_REMOVED"
 	ChangeLogEvent = "CONCEPT_CHANGE_LOG"
+	DeletedEvent   = "CONCEPT_DELETED"
 )
 
 var (
@@ -33,37 +34,140 @@ var (
 	ErrNotFound             = errors.New("concept was not found")
 	ErrDeleteSource         = errors.New("cannot delete source concept different than the canonical")
 	ErrDeleteRelated        = errors.New("cannot delete concept related with another thing")
+	ErrPreconditionFailed   = errors.New("stored concept does not match the expected aggregate hash")
 )
 
-var concordancesSources = []string{"ManagedLocation", "Smartlogic"}
-
 // ConceptService - CypherDriver - CypherDriver
 type ConceptService struct {
 	driver                  *cmneo4j.Driver
 	log                     *logger.UPPLogger
 	annotationsChangeFields []string
+	annotationsRules        *AnnotationsRules
+	locks                   *writeLocks
+	outbox                  bool
+	versions                VersionStore
+	concordancePolicy       ConcordancePolicy
+	conflicts               ConflictStore
+	queries                 queryLimiter
 }
 
-// ConceptServicer defines the functions any read-write application needs to implement
+// ConceptServicer defines the functions any read-write application needs to implement.
+//
+// Cancelling the context only stops the caller waiting, as the Neo4j driver cannot cancel a query. A read is
+// abandoned once the context is done and its query carries on in the background until it completes, holding its
+// goroutine and driver session until then; a bounded number of reads run at once, abandoned ones included.
+// A write checks the context before its transaction starts and is then waited for whatever the deadline, so that it
+// is never reported as failed while it may still commit: a context error from a write means that nothing was written.
+// Shutting down does not wait for abandoned reads.
 type ConceptServicer interface {
-	Write(thing interface{}, transID string) (updatedIds interface{}, err error)
-	Read(uuid string, transID string) (thing interface{}, found bool, err error)
-	Delete(uuid string, transID string) (uuids []string, err error)
+	Write(ctx context.Context, thing interface{}, transID string, opts WriteOptions) (updatedIds interface{}, err error)
+	Preview(ctx context.Context, thing interface{}, transID string, opts WriteOptions) (preview interface{}, err error)
+	Read(ctx context.Context, uuid string, transID string) (thing interface{}, found bool, err error)
+	LookupByAuthority(ctx context.Context, authority, authorityValue, transID string) (thing interface{}, found bool, err error)
+	LookupByIdentifier(ctx context.Context, identifier, value, transID string) (thing interface{}, found bool, err error)
+	ResolvePrefUUID(ctx context.Context, uuid, transID string) (prefUUID string, found bool, err error)
+	List(ctx context.Context, opts ListOptions, transID string) (list ConceptList, err error)
+	Stats(ctx context.Context, types []string, transID string) (stats map[string]TypeStats, err error)
+	// Delete returns the events of the deleted concepts and their uuids, or with ErrDeleteRelated and ErrDeleteSource the
+	// uuids of the concepts preventing the delete
+	Delete(ctx context.Context, uuid string, transID string) (changes ConceptChanges, err error)
+	Unconcord(ctx context.Context, prefUUID string, sourceUUIDs []string, transID string, opts WriteOptions) (changes ConceptChanges, err error)
+	Merge(ctx context.Context, prefUUID, mergedUUID string, transID string, opts MergeOptions) (changes ConceptChanges, err error)
+	ReadConcordance(ctx context.Context, uuid string, transID string) (graph ConcordanceGraph, found bool, err error)
+	ReadChanges(ctx context.Context, after string, limit int) (entries []OutboxEntry, last string, err error)
 	DecodeJSON(*json.Decoder) (thing interface{}, identity string, err error)
-	Check() error
+	Check(ctx context.Context) error
 	Initialise() error
 }
 
+// WriteOptions holds the optional conditions a caller can put on a concept write
+type WriteOptions struct {
+	// IfMatch lists the aggregate hashes the caller expects to be stored for the concept.
+	// The write is rejected with ErrPreconditionFailed when the stored concept matches none of them.
+	// "*" matches any stored concept.
+	IfMatch []string
+	// Author is recorded in the version history of the concept
+	Author string
+	// TransferConcordance moves the sources that are the prefUUID of another concordance onto the written concept,
+	// deleting the canonical node of that concordance, instead of failing. Unless the concordance policy allows the
+	// transfer anyway, every other source of that concordance must be written with them or the write fails with an
+	// IncompleteTransferError.
+	TransferConcordance bool
+	// transferIfMatch holds the aggregate hashes expected for other concepts by prefUUID, which are locked together with
+	// the written concept so that their concordance is transferred as it was read
+	transferIfMatch map[string]string
+}
+
+func (o WriteOptions) matches(existing ontology.CanonicalConcept, exists bool) bool {
+	if len(o.IfMatch) == 0 {
+		return true
+	}
+	if !exists {
+		return false
+	}
+	for _, hash := range o.IfMatch {
+		if hash == "*" || hash == existing.AggregatedHash {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceOption configures optional behaviour of the ConceptService
+type ServiceOption func(*ConceptService)
+
+// WithWriteLockTimeout sets how long a write waits for concurrent writes of the same concepts before failing with ErrLockTimeout
+func WithWriteLockTimeout(timeout time.Duration) ServiceOption {
+	return func(s *ConceptService) {
+		s.locks.timeout = timeout
+	}
+}
+
+// WithGraphWriteLocks serialises writes of the same concepts across replicas, using lock nodes in Neo4j
+func WithGraphWriteLocks() ServiceOption {
+	return func(s *ConceptService) {
+		s.locks.graph = &graphLocker{driver: s.driver, ttl: graphLockTTL}
+	}
+}
+
+// WithAnnotationsRules replaces the default rules, built from the annotations change fields, deciding whether a change
+// of a concept affects its annotations
+func WithAnnotationsRules(rules *AnnotationsRules) ServiceOption {
+	return func(s *ConceptService) {
+		s.annotationsRules = rules
+	}
+}
+
+// WithMaxConcurrentQueries sets how many reads of the service run at once, abandoned ones included
+func WithMaxConcurrentQueries(n int) ServiceOption {
+	return func(s *ConceptService) {
+		s.queries = newQueryLimiter(n)
+	}
+}
+
 // NewConceptService instantiate driver
-func NewConceptService(driver *cmneo4j.Driver, log *logger.UPPLogger, annotationsChangeFields []string) ConceptService {
-	return ConceptService{driver: driver, log: log, annotationsChangeFields: annotationsChangeFields}
+func NewConceptService(driver *cmneo4j.Driver, log *logger.UPPLogger, annotationsChangeFields []string, opts ...ServiceOption) ConceptService {
+	s := ConceptService{
+		driver:                  driver,
+		log:                     log,
+		annotationsChangeFields: annotationsChangeFields,
+		annotationsRules:        DefaultAnnotationsRules(annotationsChangeFields),
+		concordancePolicy:       DefaultConcordancePolicy(),
+		locks:                   newWriteLocks(defaultWriteLockTimeout),
+		queries:                 newQueryLimiter(defaultMaxConcurrentQueries),
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
 }
 
 // Initialise tries to create indexes and constraints if they are not already
 // created.
 func (s *ConceptService) Initialise() error {
 	err := s.driver.EnsureIndexes(map[string]string{
-		"Concept": "leiCode",
+		"Concept":             "leiCode",
+		"FinancialInstrument": "figiCode",
 	})
 
 	if err != nil {
@@ -97,17 +201,37 @@ func (s *ConceptService) Initialise() error {
 	for _, conceptType := range ontology.GetConfig().GetConceptTypes() {
 		constraintMap[conceptType] = "uuid"
 	}
+	if s.locks.graph != nil {
+		constraintMap["ConceptWriteLock"] = "key"
+	}
+	if s.outbox {
+		constraintMap["ConceptEventOutbox"] = "id"
+		constraintMap["ConceptEventRelayLease"] = "id"
+	}
 	err = s.driver.EnsureConstraints(constraintMap)
 	if err != nil {
 		s.log.WithError(err).Error("Could not run db constraints")
 		return err
 	}
 
+	if s.outbox {
+		// the relay looks for the pending entries and the cleanup for the entries delivered before the retention period
+		for _, property := range []string{"pending", "deliveredAt"} {
+			err = s.driver.EnsureIndexes(map[string]string{
+				"ConceptEventOutbox": property,
+			})
+			if err != nil {
+				s.log.WithError(err).Error("Could not run db index")
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
-func (s *ConceptService) Read(uuid string, transID string) (interface{}, bool, error) {
-	newAggregatedConcept, exists, err := s.read(uuid, transID)
+func (s *ConceptService) Read(ctx context.Context, uuid string, transID string) (interface{}, bool, error) {
+	newAggregatedConcept, exists, err := s.read(ctx, uuid, transID)
 	if err != nil {
 		return ontology.CanonicalConcept{}, exists, err
 	}
@@ -115,9 +239,9 @@ func (s *ConceptService) Read(uuid string, transID string) (interface{}, bool, e
 	return newAggregatedConcept, exists, err
 }
 
-func (s *ConceptService) read(uuid string, transID string) (ontology.CanonicalConcept, bool, error) {
+func (s *ConceptService) read(ctx context.Context, uuid string, transID string) (ontology.CanonicalConcept, bool, error) {
 	readResult := neo4j.GetReadConceptRequestQuery(uuid)
-	err := s.driver.Read(readResult.Query)
+	err := s.runRead(ctx, readResult.Query)
 	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
 		s.log.WithTransactionID(transID).WithUUID(uuid).Info("Concept not found in db")
 		return ontology.CanonicalConcept{}, false, nil
@@ -140,29 +264,166 @@ func (s *ConceptService) read(uuid string, transID string) (ontology.CanonicalCo
 	return newAggregatedConcept, true, nil
 }
 
-func (s *ConceptService) Write(thing interface{}, transID string) (interface{}, error) {
+func (s *ConceptService) Write(ctx context.Context, thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+	aggregatedConceptToWrite := thing.(ontology.CanonicalConcept)
+
+	// Concurrent writes sharing any of the concepts could otherwise both pass the concordance checks below
+	release, err := s.lockWrite(ctx, aggregatedConceptToWrite, opts)
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Could not lock concepts for writing")
+		return ConceptChanges{}, err
+	}
+	defer release()
+
+	plan, err := s.prepareWrite(ctx, aggregatedConceptToWrite, transID, opts)
+	updateRecord, queryBatch := plan.changes, plan.queries
+	if err != nil {
+		s.recordConflict(ctx, err, transID)
+		return updateRecord, err
+	}
+	if len(queryBatch) == 0 {
+		return updateRecord, nil
+	}
+
+	s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Debug("Executing " + strconv.Itoa(len(queryBatch)) + " queries")
+	if s.log.IsLevelEnabled(logrus.DebugLevel) {
+		for _, query := range queryBatch {
+			s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Debug(fmt.Sprintf("Query: %v", query))
+		}
+	}
+
+	if err = s.runWrite(ctx, queryBatch...); err != nil {
+		s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Error executing neo4j write queries. Concept NOT written.")
+		return updateRecord, err
+	}
+	if plan.version != nil {
+		// the concept is written, so failing to record its version is not worth failing the write for
+		if err := s.versions.AddVersion(ctx, *plan.version); err != nil {
+			s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Could not add the version of the concept to its history")
+		}
+	}
+	if plan.resolveConflicts {
+		// the sources of the concept are now concorded to it, so none of its conflicts is left
+		if err := s.conflicts.ResolveConflicts(ctx, aggregatedConceptToWrite.PrefUUID); err != nil {
+			s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Could not resolve the concordance conflicts of the concept")
+		}
+	}
+
+	s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Info("Concept written to db")
+	return updateRecord, nil
+}
+
+// Preview runs the same validation and concordance handling as Write and returns the events together with the queries
+// that would be executed, without writing anything to Neo4j.
+func (s *ConceptService) Preview(ctx context.Context, thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+	aggregatedConceptToWrite := thing.(ontology.CanonicalConcept)
+	plan, err := s.prepareWrite(ctx, aggregatedConceptToWrite, transID, opts)
+	if err != nil {
+		return WritePreview{}, err
+	}
+
+	preview := WritePreview{
+		ConceptChanges: plan.changes,
+		Queries:        []PlannedQuery{},
+	}
+	for _, query := range plan.queries {
+		preview.Queries = append(preview.Queries, PlannedQuery{
+			Cypher: strings.TrimSpace(query.Cypher),
+			Params: query.Params,
+		})
+	}
+	return preview, nil
+}
+
+// writePlan holds everything Write does for a concept, so that Preview can report the very same queries
+type writePlan struct {
+	changes ConceptChanges
+	queries []*cmneo4j.Query
+	// version is set when the version store cannot record it in the same transaction as the concept
+	version *ConceptVersion
+	// resolveConflicts is set when the conflict store cannot resolve them in the same transaction as the concept
+	resolveConflicts bool
+}
+
+// prepareWrite works out the events and all the queries Write executes for the aggregated concept, including the
+// outbox, version and conflict queries. An empty query batch means that the stored concept is already up to date.
+func (s *ConceptService) prepareWrite(ctx context.Context, aggregatedConceptToWrite ontology.CanonicalConcept, transID string, opts WriteOptions) (writePlan, error) {
+	updateRecord, queryBatch, err := s.prepareConceptQueries(ctx, aggregatedConceptToWrite, transID, opts)
+	plan := writePlan{changes: updateRecord, queries: queryBatch}
+	if err != nil || len(queryBatch) == 0 {
+		return plan, err
+	}
+	if s.versions != nil {
+		v, err := newVersion(aggregatedConceptToWrite, updateRecord, transID, opts)
+		if err != nil {
+			return plan, err
+		}
+		if querier, ok := s.versions.(versionQuerier); ok {
+			query, err := querier.versionQuery(v)
+			if err != nil {
+				return plan, err
+			}
+			plan.queries = append(plan.queries, query)
+		} else {
+			plan.version = &v
+		}
+	}
+	if s.conflicts != nil {
+		if querier, ok := s.conflicts.(resolveQuerier); ok {
+			plan.queries = append(plan.queries, querier.resolveQuery(aggregatedConceptToWrite.PrefUUID))
+		} else {
+			plan.resolveConflicts = true
+		}
+	}
+	if s.outbox && len(updateRecord.ChangedRecords) > 0 {
+		// the events are stored with the concept, so that they are not lost if the caller never receives them
+		query, err := outboxQuery(updateRecord.ChangedRecords)
+		if err != nil {
+			return plan, err
+		}
+		plan.queries = append(plan.queries, query)
+	}
+	return plan, nil
+}
+
+// prepareConceptQueries works out the events and the queries needed to write the aggregated concept itself.
+func (s *ConceptService) prepareConceptQueries(ctx context.Context, aggregatedConceptToWrite ontology.CanonicalConcept, transID string, opts WriteOptions) (ConceptChanges, []*cmneo4j.Query, error) {
 	// Read the aggregated concept - We need read the entire model first. This is because if we unconcord a TME concept
 	// then we need to add prefUUID to the lone node if it has been removed from the concordance listed against a Smartlogic concept
-	aggregatedConceptToWrite := thing.(ontology.CanonicalConcept)
 	aggregatedConceptToWrite = cleanSourceProperties(aggregatedConceptToWrite)
 	requestSourceData := getSourceData(aggregatedConceptToWrite.SourceRepresentations)
 
 	requestHash, err := hashstructure.Hash(aggregatedConceptToWrite, nil)
 	if err != nil {
 		s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Error hashing json from request")
-		return ConceptChanges{}, err
+		return ConceptChanges{}, nil, err
 	}
 
 	hashAsString := strconv.FormatUint(requestHash, 10)
 
 	if err = s.validateObject(aggregatedConceptToWrite, transID); err != nil {
-		return ConceptChanges{}, err
+		return ConceptChanges{}, nil, err
 	}
 
-	existingAggregateConcept, exists, err := s.read(aggregatedConceptToWrite.PrefUUID, transID)
+	existingAggregateConcept, exists, err := s.read(ctx, aggregatedConceptToWrite.PrefUUID, transID)
 	if err != nil {
 		s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Read request for existing concordance resulted in error")
-		return ConceptChanges{}, err
+		return ConceptChanges{}, nil, err
+	}
+
+	if !opts.matches(existingAggregateConcept, exists) {
+		s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Infof("Stored concept with hash %q does not match the expected hashes %v", existingAggregateConcept.AggregatedHash, opts.IfMatch)
+		return ConceptChanges{}, nil, ErrPreconditionFailed
+	}
+	for prefUUID, hash := range opts.transferIfMatch {
+		transferred, found, err := s.read(ctx, prefUUID, transID)
+		if err != nil {
+			return ConceptChanges{}, nil, err
+		}
+		if !found || transferred.AggregatedHash != hash {
+			s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Infof("Stored concept %s with hash %q does not match the expected hash %q", prefUUID, transferred.AggregatedHash, hash)
+			return ConceptChanges{}, nil, ErrPreconditionFailed
+		}
 	}
 
 	var queryBatch []*cmneo4j.Query
@@ -177,13 +438,13 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 		currentHash, err := strconv.ParseUint(existingAggregateConcept.AggregatedHash, 10, 64)
 		if err != nil {
 			s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Info("Error whilst parsing existing concept hash")
-			return updateRecord, nil
+			return updateRecord, nil, nil
 		}
 		s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Debugf("Currently stored concept has hash of %d", currentHash)
 		s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Debugf("Aggregated concept has hash of %d", requestHash)
 		if currentHash == requestHash {
 			s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Info("This concept has not changed since most recent update")
-			return updateRecord, nil
+			return updateRecord, nil, nil
 		}
 		s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Info("This concept is different to record stored in db, updating...")
 
@@ -203,9 +464,9 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 
 		//Handle scenarios for transferring source id from an existing concordance to this concordance
 		if len(conceptsToTransferConcordance) > 0 {
-			prefUUIDsToBeDeleted, err = s.handleTransferConcordance(conceptsToTransferConcordance, &updateRecord, hashAsString, aggregatedConceptToWrite, transID)
+			prefUUIDsToBeDeleted, err = s.handleTransferConcordance(ctx, conceptsToTransferConcordance, &updateRecord, hashAsString, aggregatedConceptToWrite, transID, opts)
 			if err != nil {
-				return updateRecord, err
+				return updateRecord, nil, err
 			}
 
 		}
@@ -242,8 +503,7 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 		annotationsChange, changelog, err := s.generateConceptChangeLog(existingAggregateConcept, aggregatedConceptToWrite)
 		if err != nil {
 			s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Warn("Cannot generate concept change log")
-		}
-		if changelog != "" {
+		} else {
 			//Generate concept change log event
 			updateRecord.ChangedRecords = append(updateRecord.ChangedRecords, Event{
 				ConceptType:   aggregatedConceptToWrite.Type,
@@ -258,9 +518,9 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 			})
 		}
 	} else {
-		prefUUIDsToBeDeleted, err = s.handleTransferConcordance(requestSourceData, &updateRecord, hashAsString, aggregatedConceptToWrite, transID)
+		prefUUIDsToBeDeleted, err = s.handleTransferConcordance(ctx, requestSourceData, &updateRecord, hashAsString, aggregatedConceptToWrite, transID, opts)
 		if err != nil {
-			return updateRecord, err
+			return updateRecord, nil, err
 		}
 
 		//Concept is new, send notification of all source ids
@@ -290,7 +550,7 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 		unconcordQuery, err := neo4j.WriteCanonicalForUnconcordedConcept(concept) //nolint:govet // silence shadow: declaration of "err"
 		if err != nil {
 			s.log.WithTransactionID(transID).WithUUID(concept.UUID).WithError(err).Error("failed to create prefUUID node query for unconcorded concept")
-			return nil, fmt.Errorf("failed to create prefUUID node for unconcorded concept: %w", err)
+			return ConceptChanges{}, nil, fmt.Errorf("failed to create prefUUID node for unconcorded concept: %w", err)
 		}
 		s.log.WithTransactionID(transID).WithUUID(concept.UUID).Warn("Creating prefUUID node for unconcorded concept")
 		queryBatch = append(queryBatch, unconcordQuery)
@@ -305,7 +565,7 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 	writeQueries, err := neo4j.WriteCanonicalConceptQueries(aggregatedConceptToWrite)
 	if err != nil {
 		s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).WithError(err).Error("failed to create query for canonical concept")
-		return nil, fmt.Errorf("failed to create query for canonical concept: %w", err)
+		return ConceptChanges{}, nil, fmt.Errorf("failed to create query for canonical concept: %w", err)
 	}
 	queryBatch = append(queryBatch, writeQueries...)
 
@@ -323,13 +583,13 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 			Result: &fiRes,
 		}
 
-		err := s.driver.Read(issuerQuery)
+		err := s.runRead(ctx, issuerQuery)
 		if err != nil && !errors.Is(err, cmneo4j.ErrNoResultsFound) {
 			s.log.WithError(err).
 				WithTransactionID(transID).
 				WithUUID(aggregatedConceptToWrite.PrefUUID).
 				Error("Could not get existing issuer.")
-			return updateRecord, err
+			return updateRecord, nil, err
 		}
 
 		for _, fi := range fiRes {
@@ -368,20 +628,7 @@ func (s *ConceptService) Write(thing interface{}, transID string) (interface{},
 		}
 	}
 
-	s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Debug("Executing " + strconv.Itoa(len(queryBatch)) + " queries")
-	if s.log.IsLevelEnabled(logrus.DebugLevel) {
-		for _, query := range queryBatch {
-			s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Debug(fmt.Sprintf("Query: %v", query))
-		}
-	}
-
-	if err = s.driver.Write(queryBatch...); err != nil {
-		s.log.WithError(err).WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Error("Error executing neo4j write queries. Concept NOT written.")
-		return updateRecord, err
-	}
-
-	s.log.WithTransactionID(transID).WithUUID(aggregatedConceptToWrite.PrefUUID).Info("Concept written to db")
-	return updateRecord, nil
+	return updateRecord, queryBatch, nil
 }
 
 func (s *ConceptService) validateObject(aggConcept ontology.CanonicalConcept, transID string) error {
@@ -405,54 +652,204 @@ func (s *ConceptService) validateObject(aggConcept ontology.CanonicalConcept, tr
 	return requestError{err.Error()}
 }
 
-func (s *ConceptService) Delete(uuid string, transID string) ([]string, error) {
+func (s *ConceptService) Delete(ctx context.Context, uuid string, transID string) (ConceptChanges, error) {
 	logEntry := s.log.WithUUID(uuid).WithTransactionID(transID)
 
-	query, result := readConceptRelations(uuid)
-	err := s.driver.Read(query)
+	release, result, err := s.lockConcordance(ctx, uuid)
 	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
-		return nil, ErrNotFound
+		return ConceptChanges{}, ErrNotFound
 	}
 	if err != nil {
-		logEntry.WithError(err).Error("could not find concept to delete")
-		return nil, err
+		logEntry.WithError(err).Error("could not lock concept for deleting")
+		return ConceptChanges{}, err
 	}
+	defer release()
 
 	// One of the source concepts has incoming relationships
 	if result.Incoming > 0 {
-		return result.IncomingUUIDs, ErrDeleteRelated
+		return ConceptChanges{UpdatedIds: result.IncomingUUIDs}, ErrDeleteRelated
 	}
 
 	// Trying to delete a source concept not a canonical.
 	if result.UUID != result.PrefUUID {
-		return []string{result.PrefUUID}, ErrDeleteSource
+		return ConceptChanges{UpdatedIds: []string{result.PrefUUID}}, ErrDeleteSource
+	}
+
+	changes := ConceptChanges{
+		ChangedRecords: deletedEvents(result, transID),
+		UpdatedIds:     result.ConcordancesUUIDs,
 	}
 
 	// Delete the canonical and all source concepts
-	query = &cmneo4j.Query{
+	queries := []*cmneo4j.Query{{
 		Cypher: `
 			MATCH (canonical:Concept{prefUUID:$uuid})<-[:EQUIVALENT_TO]-(concept:Concept)
 			DETACH DELETE concept, canonical`,
 		Params: map[string]interface{}{
 			"uuid": uuid,
 		},
+	}}
+	if s.outbox && len(changes.ChangedRecords) > 0 {
+		query, err := outboxQuery(changes.ChangedRecords)
+		if err != nil {
+			return changes, err
+		}
+		queries = append(queries, query)
 	}
-	err = s.driver.Write(query)
+	err = s.runWrite(ctx, queries...)
 	if err != nil {
 		logEntry.WithError(err).Error("could not delete concept")
-		return result.ConcordancesUUIDs, err
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+// maxConcordanceLockAttempts bounds how many times Write and Delete lock a concordance whose sources keep changing
+const maxConcordanceLockAttempts = 3
+
+// lockWrite locks the concepts of the aggregated concept together with the sources stored under its prefUUID, which
+// the write unconcords when they are left out of it. The stored sources are read before locking them, so they are
+// read again once locked until they have not changed.
+func (s *ConceptService) lockWrite(ctx context.Context, concept ontology.CanonicalConcept, opts WriteOptions) (func(), error) {
+	keys := writeLockKeys(concept)
+	for prefUUID := range opts.transferIfMatch {
+		keys = append(keys, prefUUID)
+	}
+	stored, err := s.readStoredSources(ctx, concept.PrefUUID)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		lockKeys := append(slices.Clone(keys), stored...)
+		release, err := s.locks.acquire(ctx, lockKeys)
+		if err != nil {
+			return nil, err
+		}
+		current, err := s.readStoredSources(ctx, concept.PrefUUID)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if containsAll(lockKeys, current) {
+			return release, nil
+		}
+		release()
+		if attempt == maxConcordanceLockAttempts {
+			return nil, fmt.Errorf("the concordance of concept %s kept changing while locking it", concept.PrefUUID)
+		}
+		stored = current
+	}
+}
+
+// readStoredSources returns the uuids of the sources concorded to the canonical concept with the prefUUID
+func (s *ConceptService) readStoredSources(ctx context.Context, prefUUID string) ([]string, error) {
+	var result []struct {
+		UUID string `json:"uuid"`
 	}
+	query := &cmneo4j.Query{
+		Cypher: `
+			MATCH (:Thing{prefUUID:$prefUUID})<-[:EQUIVALENT_TO]-(source:Concept)
+			RETURN source.uuid as uuid`,
+		Params: map[string]interface{}{
+			"prefUUID": prefUUID,
+		},
+		Result: &result,
+	}
+	if err := s.runRead(ctx, query); err != nil && !errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return nil, err
+	}
+	var uuids []string
+	for _, source := range result {
+		uuids = append(uuids, source.UUID)
+	}
+	return uuids, nil
+}
 
-	return result.ConcordancesUUIDs, nil
+// lockConcordance locks the concept with the uuid together with its canonical concept and all its sources, the same
+// keys a write of the canonical concept locks, and returns their relations read under the lock. The sources are read
+// before locking them, so they are read again once locked until they have not changed.
+func (s *ConceptService) lockConcordance(ctx context.Context, uuid string) (func(), *relationsResult, error) {
+	keys := []string{uuid}
+	for attempt := 1; ; attempt++ {
+		release, err := s.locks.acquire(ctx, keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		query, result := readConceptRelations(uuid)
+		if err := s.runRead(ctx, query); err != nil {
+			release()
+			return nil, nil, err
+		}
+		lockKeys := concordanceLockKeys(uuid, result)
+		if containsAll(keys, lockKeys) {
+			return release, result, nil
+		}
+		release()
+		if attempt == maxConcordanceLockAttempts {
+			return nil, nil, fmt.Errorf("the concordance of concept %s kept changing while locking it", uuid)
+		}
+		keys = lockKeys
+	}
+}
+
+// concordanceLockKeys returns the keys writeLockKeys returns for the canonical concept of the relations
+func concordanceLockKeys(uuid string, result *relationsResult) []string {
+	return append([]string{uuid, result.PrefUUID}, result.ConcordancesUUIDs...)
+}
+
+func containsAll(values, wanted []string) bool {
+	for _, value := range wanted {
+		if !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// deletedEvents returns a CONCEPT_DELETED event for every source concept and for the canonical concept, all with the
+// last aggregate hash of the canonical concept.
+func deletedEvents(result *relationsResult, transID string) []Event {
+	var events []Event
+	add := func(uuid string, types []string) {
+		conceptType, _ := ontology.MostSpecificType(types)
+		events = append(events, Event{
+			ConceptType:   conceptType,
+			ConceptUUID:   uuid,
+			AggregateHash: result.AggregateHash,
+			TransactionID: transID,
+			EventDetails: ConceptEvent{
+				Type: DeletedEvent,
+			},
+		})
+	}
+
+	canonicalIsSource := false
+	for _, concept := range result.ConcordancesNodes {
+		add(concept.UUID, concept.Types)
+		canonicalIsSource = canonicalIsSource || concept.UUID == result.PrefUUID
+	}
+	if !canonicalIsSource {
+		add(result.PrefUUID, result.Types)
+	}
+	return events
 }
 
 type relationsResult struct {
-	Concordances      int      `json:"concordances"`
-	Incoming          int      `json:"incoming"`
-	ConcordancesUUIDs []string `json:"concordances_uuids"`
-	IncomingUUIDs     []string `json:"incoming_uuids"`
-	UUID              string   `json:"uuid"`
-	PrefUUID          string   `json:"prefUUID"`
+	Concordances      int           `json:"concordances"`
+	Incoming          int           `json:"incoming"`
+	ConcordancesUUIDs []string      `json:"concordances_uuids"`
+	ConcordancesNodes []conceptNode `json:"concordances_nodes"`
+	IncomingUUIDs     []string      `json:"incoming_uuids"`
+	UUID              string        `json:"uuid"`
+	PrefUUID          string        `json:"prefUUID"`
+	Types             []string      `json:"types"`
+	AggregateHash     string        `json:"aggregateHash"`
+}
+
+type conceptNode struct {
+	UUID  string   `json:"uuid"`
+	Types []string `json:"types"`
 }
 
 // readConceptRelations will count the number of concordances and their incoming relationships for a given canonical concept.
@@ -466,10 +863,12 @@ func readConceptRelations(uuid string) (*cmneo4j.Query, *relationsResult) {
 		   WITH COUNT(DISTINCT other) as concordances,
 			  COUNT(DISTINCT t) as incoming,
 			  COLLECT(DISTINCT other.uuid) as concordances_uuids,
+			  COLLECT(DISTINCT {uuid: other.uuid, types: labels(other)}) as concordances_nodes,
 			  COLLECT(DISTINCT t.uuid) as incoming_uuids,
 			  concept, canonical
-		   RETURN concordances, incoming, concordances_uuids, incoming_uuids,
-				 concept.uuid as uuid, canonical.prefUUID as prefUUID`,
+		   RETURN concordances, incoming, concordances_uuids, concordances_nodes, incoming_uuids,
+				 concept.uuid as uuid, canonical.prefUUID as prefUUID,
+				 labels(canonical) as types, canonical.aggregateHash as aggregateHash`,
 		Params: map[string]interface{}{
 			"uuid": uuid,
 		},
@@ -480,12 +879,12 @@ func readConceptRelations(uuid string) (*cmneo4j.Query, *relationsResult) {
 
 // Handle new source nodes that have been added to current concordance
 // nolint:gocognit
-func (s *ConceptService) handleTransferConcordance(conceptData map[string]string, updateRecord *ConceptChanges, aggregateHash string, newAggregatedConcept ontology.CanonicalConcept, transID string) ([]string, error) {
+func (s *ConceptService) handleTransferConcordance(ctx context.Context, conceptData map[string]string, updateRecord *ConceptChanges, aggregateHash string, newAggregatedConcept ontology.CanonicalConcept, transID string, opts WriteOptions) ([]string, error) {
 	var canonicalUUIDsToRemove []string
 	for updatedSourceID := range conceptData {
 		equivQuery, result := readCanonicalStats(updatedSourceID)
 
-		err := s.driver.Read(equivQuery)
+		err := s.runRead(ctx, equivQuery)
 		if err != nil && !errors.Is(err, cmneo4j.ErrNoResultsFound) {
 			s.log.WithError(err).WithTransactionID(transID).WithUUID(newAggregatedConcept.PrefUUID).Error("Requests for source nodes canonical information resulted in error")
 			return nil, err
@@ -566,7 +965,14 @@ func (s *ConceptService) handleTransferConcordance(conceptData map[string]string
 			if updatedSourceID == entityEquivalence.PrefUUID {
 				if updatedSourceID != newAggregatedConcept.PrefUUID {
 					authority := newAggregatedConcept.GetCanonicalAuthority()
-					if entityEquivalence.Authority != authority && stringInArr(entityEquivalence.Authority, concordancesSources) {
+					allowed := s.concordancePolicy.AllowsTransfer(newAggregatedConcept.Type, entityEquivalence.Authority, authority)
+					if !allowed && opts.TransferConcordance {
+						// a forced transfer must not leave the other sources of the concordance without a canonical node
+						if err := s.checkTransferredSources(ctx, entityEquivalence.PrefUUID, newAggregatedConcept); err != nil {
+							return nil, err
+						}
+					}
+					if allowed || opts.TransferConcordance {
 						s.log.WithTransactionID(transID).WithUUID(newAggregatedConcept.PrefUUID).Debugf("Canonical node for main source %s will need to be deleted and all concordances will be transferred to the new concordance", updatedSourceID)
 						// just delete the lone prefUUID node because the other concordances to
 						// this node should already be in the new sourceRepresentations (aggregate-concept-transformer responsability)
@@ -585,7 +991,7 @@ func (s *ConceptService) handleTransferConcordance(conceptData map[string]string
 						continue
 					}
 					// Source is prefUUID for a different concordance
-					err := fmt.Errorf("Cannot currently process this record as it will break an existing concordance with prefUuid: %s", updatedSourceID)
+					err := s.concordanceConflict(ctx, updatedSourceID, entityEquivalence.Authority, newAggregatedConcept, transID)
 					s.log.WithTransactionID(transID).WithUUID(newAggregatedConcept.PrefUUID).WithField("alert_tag", "ConceptLoadingInvalidConcordance").Error(err)
 					return nil, err
 				}
@@ -631,6 +1037,39 @@ type equivalenceResult struct {
 	Authority   string   `json:"authority"`
 }
 
+// checkTransferredSources fails with an IncompleteTransferError when the concept does not have all the sources of the
+// concordance with the prefUUID it takes over
+func (s *ConceptService) checkTransferredSources(ctx context.Context, prefUUID string, concept ontology.CanonicalConcept) error {
+	var result []struct {
+		UUID string `json:"uuid"`
+	}
+	err := s.runRead(ctx, &cmneo4j.Query{
+		Cypher: `
+			MATCH (:Thing {prefUUID:$prefUUID})<-[:EQUIVALENT_TO]-(source:Thing)
+			RETURN source.uuid AS uuid
+			ORDER BY uuid`,
+		Params: map[string]interface{}{
+			"prefUUID": prefUUID,
+		},
+		Result: &result,
+	})
+	if err != nil && !errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return err
+	}
+
+	written := getSourceData(concept.SourceRepresentations)
+	var missing []string
+	for _, r := range result {
+		if _, ok := written[r.UUID]; !ok {
+			missing = append(missing, r.UUID)
+		}
+	}
+	if len(missing) > 0 {
+		return &IncompleteTransferError{PrefUUID: prefUUID, MissingSources: missing}
+	}
+	return nil
+}
+
 // readCanonicalStats will generate a Neo4j query that will read equivalenceResult that contains a count of the concorded source concepts
 // This information is used for determining how to proseed when concording concepts
 func readCanonicalStats(uuid string) (*cmneo4j.Query, *[]equivalenceResult) {
@@ -661,6 +1100,15 @@ func removeLoneCanonicalNode(prefUUID string) *cmneo4j.Query {
 	return equivQuery
 }
 
+// writeLockKeys returns the uuids of all concepts affected by writing the aggregated concept
+func writeLockKeys(concept ontology.CanonicalConcept) []string {
+	keys := []string{concept.PrefUUID}
+	for _, source := range concept.SourceRepresentations {
+		keys = append(keys, source.UUID)
+	}
+	return keys
+}
+
 // extract uuids of the source concepts
 func getSourceData(sourceConcepts []ontology.SourceConcept) map[string]string {
 	conceptData := make(map[string]string)
@@ -690,8 +1138,24 @@ func (s *ConceptService) DecodeJSON(dec *json.Decoder) (interface{}, string, err
 }
 
 // Check - checker
-func (s *ConceptService) Check() error {
-	return s.driver.VerifyWriteConnectivity()
+func (s *ConceptService) Check(ctx context.Context) error {
+	return s.queries.run(ctx, s.driver.VerifyWriteConnectivity)
+}
+
+// runRead executes the read queries, returning as soon as the context is done.
+func (s *ConceptService) runRead(ctx context.Context, queries ...*cmneo4j.Query) error {
+	return s.queries.run(ctx, func() error {
+		return s.driver.Read(queries...)
+	})
+}
+
+// runWrite executes the write queries in a single transaction if the context is not done yet.
+// Once started the transaction is waited for, so that the caller knows whether the queries were applied.
+func (s *ConceptService) runWrite(ctx context.Context, queries ...*cmneo4j.Query) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.driver.Write(queries...)
 }
 
 type requestError struct {
@@ -734,62 +1198,25 @@ func cleanSourceProperties(c ontology.CanonicalConcept) ontology.CanonicalConcep
 	return c
 }
 
-func stringInArr(searchFor string, values []string) bool {
-	for _, val := range values {
-		if searchFor == val {
-			return true
-		}
-	}
-	return false
-}
-
-func (s *ConceptService) generateConceptChangeLog(ec ontology.CanonicalConcept, nc ontology.CanonicalConcept) (bool, string, error) {
-	// Sort source representations in the new concept state in the order of the old concept state for cleaner change log
+func (s *ConceptService) generateConceptChangeLog(ec ontology.CanonicalConcept, nc ontology.CanonicalConcept) (bool, ChangeLog, error) {
+	// Sort the relationships of both concept states for a cleaner change log
 	sortSourceRepresentations(ec, nc)
 
 	existingAggregateConcept, err := mappify(ec)
 	if err != nil {
-		return false, "", err
+		return false, nil, err
 	}
 	aggregatedConceptToWrite, err := mappify(nc)
 	if err != nil {
-		return false, "", err
+		return false, nil, err
 	}
 
-	changelog, err := diff.Diff(existingAggregateConcept, aggregatedConceptToWrite)
+	changelog, err := diffConcepts(existingAggregateConcept, aggregatedConceptToWrite)
 	if err != nil {
-		return false, "", err
+		return false, nil, err
 	}
 
-	// Check for changes of NAICS with rank 1
-	annotationsChange := checkNaicsIndustryClassifications(existingAggregateConcept, aggregatedConceptToWrite)
-
-	if !annotationsChange {
-		for _, change := range changelog {
-			// Check for changes of configured annotations change fields only in the canonical concept
-			for _, field := range s.annotationsChangeFields {
-				if slices.Contains(change.Path, field) && len(change.Path) == 1 {
-					annotationsChange = true
-					break
-				}
-			}
-
-			if annotationsChange {
-				break
-			}
-		}
-	}
-
-	sort.Slice(changelog, func(i, j int) bool {
-		return fmt.Sprint(changelog[i].Path) < fmt.Sprint(changelog[j].Path)
-	})
-
-	result, err := json.Marshal(changelog)
-	if err != nil {
-		return false, "", err
-	}
-
-	return annotationsChange, string(result), nil
+	return s.annotationsRules.AnnotationsChange(existingAggregateConcept, aggregatedConceptToWrite, changelog), changelog, nil
 }
 
 func sortConcept(concept ontology.CanonicalConcept) {
@@ -837,31 +1264,6 @@ func sortSourceRepresentations(ec ontology.CanonicalConcept, nc ontology.Canonic
 	nc.SourceRepresentations = sourceSlice
 }
 
-func checkNaicsIndustryClassifications(ec map[string]interface{}, nc map[string]interface{}) bool {
-	existingNaicsUUID := getNaicsUUIDForRank1(ec)
-	newNaicsUUID := getNaicsUUIDForRank1(nc)
-
-	return existingNaicsUUID != newNaicsUUID
-}
-
-func getNaicsUUIDForRank1(ac map[string]interface{}) string {
-	var uuid string
-	for _, source := range ac["sourceRepresentations"].([]interface{}) {
-		naicsIndustryClassifications, ok := source.(map[string]interface{})["naicsIndustryClassifications"].([]interface{})
-		if ok {
-			for _, n := range naicsIndustryClassifications {
-				naics := n.(map[string]interface{})
-				if naics["rank"] == float64(1) {
-					uuid = naics["uuid"].(string)
-					break
-				}
-			}
-		}
-	}
-
-	return uuid
-}
-
 func mappify(concept interface{}) (map[string]interface{}, error) {
 	data, err := json.Marshal(concept)
 	if err != nil {
@@ -0,0 +1,254 @@
+package concepts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+)
+
+const supersededByRelationship = "SUPERSEDED_BY"
+
+// MergeOptions holds the optional behaviour of a merge
+type MergeOptions struct {
+	WriteOptions
+	// SupersededBy adds a SUPERSEDED_BY relationship from the source whose uuid was the prefUUID of the merged concept to
+	// the concept it is merged into. The relationship is written like any other relationship of the source: it is part
+	// of the aggregate hash, it is returned by reads and a later PUT leaving it out removes it.
+	SupersededBy bool
+}
+
+// Unconcord detaches the sources from the canonical concept, writing the canonical concept without them so that they
+// get their own canonical nodes back and CONCORDANCE_REMOVED events are emitted as when they are left out of a PUT.
+// Unless the options say otherwise, the write only succeeds if the canonical concept has not changed since it was read.
+func (s *ConceptService) Unconcord(ctx context.Context, prefUUID string, sourceUUIDs []string, transID string, opts WriteOptions) (ConceptChanges, error) {
+	existing, found, err := s.read(ctx, prefUUID, transID)
+	if err != nil {
+		return ConceptChanges{}, err
+	}
+	if !found {
+		return ConceptChanges{}, ErrNotFound
+	}
+
+	concept, err := withoutSources(existing, sourceUUIDs)
+	if err != nil {
+		return ConceptChanges{}, err
+	}
+	if len(opts.IfMatch) == 0 {
+		opts.IfMatch = []string{existing.AggregatedHash}
+	}
+	output, err := s.Write(ctx, concept, transID, opts)
+	changes, _ := output.(ConceptChanges)
+	return changes, err
+}
+
+// withoutSources returns the canonical concept without the given sources, its aggregate hash being worked out again by
+// the write
+func withoutSources(concept ontology.CanonicalConcept, sourceUUIDs []string) (ontology.CanonicalConcept, error) {
+	remove := map[string]bool{}
+	for _, uuid := range sourceUUIDs {
+		if uuid == concept.PrefUUID {
+			return ontology.CanonicalConcept{}, requestError{fmt.Sprintf("%s is the prefUUID of the concept and cannot be unconcorded", uuid)}
+		}
+		remove[uuid] = true
+	}
+
+	var sources []ontology.SourceConcept
+	for _, source := range concept.SourceRepresentations {
+		if remove[source.UUID] {
+			delete(remove, source.UUID)
+			continue
+		}
+		sources = append(sources, source)
+	}
+	for _, uuid := range sourceUUIDs {
+		if remove[uuid] {
+			return ontology.CanonicalConcept{}, requestError{fmt.Sprintf("%s is not a source of concept %s", uuid, concept.PrefUUID)}
+		}
+	}
+	if len(sources) == 0 {
+		return ontology.CanonicalConcept{}, requestError{fmt.Sprintf("cannot unconcord all the sources of concept %s, delete it instead", concept.PrefUUID)}
+	}
+
+	concept.SourceRepresentations = sources
+	concept.AggregatedHash = ""
+	return concept, nil
+}
+
+// Merge moves every source of the canonical concept with mergedUUID onto the one with prefUUID, deleting the canonical
+// node of the merged concept. The events are the CONCORDANCE_REMOVED and CONCORDANCE_ADDED events of transferring the
+// sources of a concordance to another. The write only succeeds if the merged concept has not changed since it was read,
+// nor, unless the options say otherwise, the concept merged into.
+func (s *ConceptService) Merge(ctx context.Context, prefUUID, mergedUUID string, transID string, opts MergeOptions) (ConceptChanges, error) {
+	if prefUUID == mergedUUID {
+		return ConceptChanges{}, requestError{"cannot merge a concept into itself"}
+	}
+	target, found, err := s.read(ctx, prefUUID, transID)
+	if err != nil {
+		return ConceptChanges{}, err
+	}
+	if !found {
+		return ConceptChanges{}, ErrNotFound
+	}
+	merged, found, err := s.read(ctx, mergedUUID, transID)
+	if err != nil {
+		return ConceptChanges{}, err
+	}
+	if !found {
+		return ConceptChanges{}, requestError{fmt.Sprintf("concept %s to merge was not found", mergedUUID)}
+	}
+	if merged.Type != target.Type {
+		return ConceptChanges{}, requestError{fmt.Sprintf("cannot merge concept %s of type %s into a concept of type %s", mergedUUID, merged.Type, target.Type)}
+	}
+
+	concept := target
+	concept.SourceRepresentations = append(append([]ontology.SourceConcept{}, target.SourceRepresentations...), merged.SourceRepresentations...)
+	concept.AggregatedHash = ""
+
+	writeOpts := opts.WriteOptions
+	if len(writeOpts.IfMatch) == 0 {
+		writeOpts.IfMatch = []string{target.AggregatedHash}
+	}
+	// the sources of the merged concept are all written, so its canonical node can go
+	writeOpts.TransferConcordance = true
+	writeOpts.transferIfMatch = map[string]string{mergedUUID: merged.AggregatedHash}
+	if opts.SupersededBy {
+		concept.SourceRepresentations = supersede(concept.SourceRepresentations, mergedUUID, prefUUID)
+	}
+	output, err := s.Write(ctx, concept, transID, writeOpts)
+	changes, _ := output.(ConceptChanges)
+	return changes, err
+}
+
+// supersede returns the sources with a SUPERSEDED_BY relationship from the source with the uuid to the prefUUID, the
+// relationships of that source being copied so that the read concept is left as it was
+func supersede(sources []ontology.SourceConcept, uuid, prefUUID string) []ontology.SourceConcept {
+	for i, source := range sources {
+		if source.UUID != uuid {
+			continue
+		}
+		for _, rel := range source.Relationships {
+			if rel.Label == supersededByRelationship && rel.UUID == prefUUID {
+				return sources
+			}
+		}
+		rels := append(ontology.Relationships{}, source.Relationships...)
+		sources[i].Relationships = append(rels, ontology.Relationship{UUID: prefUUID, Label: supersededByRelationship})
+	}
+	return sources
+}
+
+// ConcordanceGraph is the canonical node of a concept together with the source nodes EQUIVALENT_TO it
+type ConcordanceGraph struct {
+	Canonical ConcordanceCanonical `json:"canonical"`
+	Sources   []ConcordanceSource  `json:"sources"`
+}
+
+// ConcordanceCanonical is the canonical node of a concordance
+type ConcordanceCanonical struct {
+	PrefUUID      string `json:"prefUUID"`
+	PrefLabel     string `json:"prefLabel"`
+	Type          string `json:"type"`
+	AggregateHash string `json:"aggregateHash,omitempty"`
+}
+
+// ConcordanceSource is a source node of a concordance
+type ConcordanceSource struct {
+	UUID           string `json:"uuid"`
+	PrefLabel      string `json:"prefLabel"`
+	Type           string `json:"type"`
+	Authority      string `json:"authority"`
+	AuthorityValue string `json:"authorityValue"`
+	// Incoming counts the relationships of other things to the source, any of them preventing the concept from being
+	// deleted
+	Incoming int `json:"incoming"`
+	// IncomingTypes counts these relationships by type
+	IncomingTypes map[string]int `json:"incomingTypes,omitempty"`
+}
+
+type concordanceResult struct {
+	PrefUUID      string   `json:"prefUUID"`
+	PrefLabel     string   `json:"prefLabel"`
+	Types         []string `json:"types"`
+	AggregateHash string   `json:"aggregateHash"`
+	Sources       []struct {
+		UUID           string   `json:"uuid"`
+		PrefLabel      string   `json:"prefLabel"`
+		Types          []string `json:"types"`
+		Authority      string   `json:"authority"`
+		AuthorityValue string   `json:"authorityValue"`
+		Incoming       []struct {
+			Type  string `json:"type"`
+			Count int    `json:"count"`
+		} `json:"incoming"`
+	} `json:"sources"`
+}
+
+// ReadConcordance returns the concordance of the concept with the uuid, which is either its prefUUID or the uuid of one
+// of its sources, with the incoming relationships of every source that Delete checks for.
+func (s *ConceptService) ReadConcordance(ctx context.Context, uuid string, transID string) (ConcordanceGraph, bool, error) {
+	var result concordanceResult
+	err := s.runRead(ctx, &cmneo4j.Query{
+		Cypher: `
+			MATCH (concept:Concept{uuid:$uuid})-[:EQUIVALENT_TO]->(canonical:Concept)
+			MATCH (canonical)<-[:EQUIVALENT_TO]-(source:Concept)
+			OPTIONAL MATCH (source)<-[rel]-(:Thing)
+			WITH canonical, source, type(rel) AS relType, count(rel) AS relCount
+			WITH canonical, source, collect({type: relType, count: relCount}) AS incoming
+			ORDER BY source.uuid
+			RETURN canonical.prefUUID AS prefUUID, canonical.prefLabel AS prefLabel, labels(canonical) AS types,
+				canonical.aggregateHash AS aggregateHash,
+				collect({uuid: source.uuid, prefLabel: source.prefLabel, types: labels(source), authority: source.authority,
+					authorityValue: source.authorityValue, incoming: incoming}) AS sources`,
+		Params: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &result,
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return ConcordanceGraph{}, false, nil
+	}
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).WithUUID(uuid).Error("Error reading the concordance of the concept")
+		return ConcordanceGraph{}, false, err
+	}
+
+	canonicalType, err := ontology.MostSpecificType(result.Types)
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).WithUUID(uuid).Errorf("could not return most specific type from canonical node: %v", result.Types)
+		return ConcordanceGraph{}, false, err
+	}
+	graph := ConcordanceGraph{
+		Canonical: ConcordanceCanonical{
+			PrefUUID:      result.PrefUUID,
+			PrefLabel:     result.PrefLabel,
+			Type:          canonicalType,
+			AggregateHash: result.AggregateHash,
+		},
+		Sources: make([]ConcordanceSource, 0, len(result.Sources)),
+	}
+	for _, r := range result.Sources {
+		source := ConcordanceSource{
+			UUID:           r.UUID,
+			PrefLabel:      r.PrefLabel,
+			Authority:      r.Authority,
+			AuthorityValue: r.AuthorityValue,
+		}
+		source.Type, _ = ontology.MostSpecificType(r.Types)
+		for _, rel := range r.Incoming {
+			// a source without incoming relationships has a single entry without a type
+			if rel.Type == "" {
+				continue
+			}
+			if source.IncomingTypes == nil {
+				source.IncomingTypes = map[string]int{}
+			}
+			source.IncomingTypes[rel.Type] += rel.Count
+			source.Incoming += rel.Count
+		}
+		graph.Sources = append(graph.Sources, source)
+	}
+	return graph, true, nil
+}
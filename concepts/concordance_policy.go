@@ -0,0 +1,126 @@
+package concepts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"golang.org/x/exp/slices"
+)
+
+// AnyAuthority matches every authority in a concordance transfer
+const AnyAuthority = "*"
+
+// ConcordancePolicy decides when the canonical concept led by a source can be taken over by another canonical concept
+// whose sources include it, the canonical node of the former being deleted.
+type ConcordancePolicy struct {
+	// Default applies to the concept types without a rule of their own
+	Default ConcordanceRule `json:"default"`
+	// ConceptTypes holds the rules of the concept types, keyed by the type of the concept being written
+	ConceptTypes map[string]ConcordanceRule `json:"conceptTypes,omitempty"`
+}
+
+// ConcordanceRule allows the transfers it lists, as well as the transfers to a canonical concept whose authority comes
+// before the authority of the existing one in Authorities.
+type ConcordanceRule struct {
+	// Authorities lists authorities in order of precedence, the first one being the master authority
+	Authorities []string              `json:"authorities,omitempty"`
+	Transfers   []ConcordanceTransfer `json:"transfers,omitempty"`
+}
+
+// ConcordanceTransfer allows a canonical concept led by a source of the From authority to be taken over by a canonical
+// concept of the To authority
+type ConcordanceTransfer struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DefaultConcordancePolicy lets canonical concepts led by ManagedLocation or Smartlogic be taken over by a canonical
+// concept of any other authority
+func DefaultConcordancePolicy() ConcordancePolicy {
+	return ConcordancePolicy{
+		Default: ConcordanceRule{
+			Transfers: []ConcordanceTransfer{
+				{From: "ManagedLocation", To: AnyAuthority},
+				{From: "Smartlogic", To: AnyAuthority},
+			},
+		},
+	}
+}
+
+// LoadConcordancePolicy reads the policy from a JSON file
+func LoadConcordancePolicy(path string) (ConcordancePolicy, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return ConcordancePolicy{}, err
+	}
+	var policy ConcordancePolicy
+	if err := json.Unmarshal(body, &policy); err != nil {
+		return ConcordancePolicy{}, fmt.Errorf("invalid concordance policy file %s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return ConcordancePolicy{}, fmt.Errorf("invalid concordance policy file %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p ConcordancePolicy) validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default rule: %w", err)
+	}
+	for conceptType, rule := range p.ConceptTypes {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule of %s: %w", conceptType, err)
+		}
+	}
+	return nil
+}
+
+func (r ConcordanceRule) validate() error {
+	for _, transfer := range r.Transfers {
+		if transfer.From == "" || transfer.To == "" {
+			return fmt.Errorf("transfer %+v needs both an authority from and to", transfer)
+		}
+	}
+	return nil
+}
+
+// WithConcordancePolicy replaces the default concordance policy
+func WithConcordancePolicy(policy ConcordancePolicy) ServiceOption {
+	return func(s *ConceptService) {
+		s.concordancePolicy = policy
+	}
+}
+
+// AllowsTransfer reports whether the canonical concept of the given type led by the from authority can be taken over
+// by a canonical concept of the to authority. A canonical concept is never taken over by one of the same authority.
+func (p ConcordancePolicy) AllowsTransfer(conceptType, from, to string) bool {
+	if from == to {
+		return false
+	}
+	rule, ok := p.ConceptTypes[conceptType]
+	if !ok {
+		rule = p.Default
+	}
+	for _, transfer := range rule.Transfers {
+		if (transfer.From == AnyAuthority || transfer.From == from) && (transfer.To == AnyAuthority || transfer.To == to) {
+			return true
+		}
+	}
+	toRank, fromRank := slices.Index(rule.Authorities, to), slices.Index(rule.Authorities, from)
+	return toRank >= 0 && (fromRank < 0 || toRank < fromRank)
+}
+
+// GetConcordancePolicy returns the concordance policy in use
+func (h *ConceptsHandler) GetConcordancePolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transactionidutils.GetTransactionIDFromRequest(r))
+
+	policy := DefaultConcordancePolicy()
+	if h.ConcordancePolicy != nil {
+		policy = *h.ConcordancePolicy
+	}
+	writeJSON(w, http.StatusOK, policy)
+}
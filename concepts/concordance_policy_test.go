@@ -0,0 +1,60 @@
+package concepts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcordancePolicyAllowsTransfer(t *testing.T) {
+	policy := ConcordancePolicy{
+		Default: DefaultConcordancePolicy().Default,
+		ConceptTypes: map[string]ConcordanceRule{
+			"Organisation": {
+				Authorities: []string{"FactSet", "TME"},
+				Transfers:   []ConcordanceTransfer{{From: "Smartlogic", To: "TME"}},
+			},
+		},
+	}
+	tests := []struct {
+		name        string
+		conceptType string
+		from        string
+		to          string
+		expected    bool
+	}{
+		{name: "Default transfer", conceptType: "Brand", from: "Smartlogic", to: "TME", expected: true},
+		{name: "Default transfer from ManagedLocation", conceptType: "Location", from: "ManagedLocation", to: "Wikidata", expected: true},
+		{name: "Default without transfer", conceptType: "Brand", from: "TME", to: "Smartlogic", expected: false},
+		{name: "Same authority", conceptType: "Brand", from: "Smartlogic", to: "Smartlogic", expected: false},
+		{name: "Type transfer", conceptType: "Organisation", from: "Smartlogic", to: "TME", expected: true},
+		{name: "Type rule replaces default", conceptType: "Organisation", from: "ManagedLocation", to: "Wikidata", expected: false},
+		{name: "Higher precedence", conceptType: "Organisation", from: "TME", to: "FactSet", expected: true},
+		{name: "Lower precedence", conceptType: "Organisation", from: "FactSet", to: "TME", expected: false},
+		{name: "Unranked authority", conceptType: "Organisation", from: "Wikidata", to: "TME", expected: true},
+		{name: "To unranked authority", conceptType: "Organisation", from: "TME", to: "Wikidata", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, policy.AllowsTransfer(test.conceptType, test.from, test.to))
+		})
+	}
+}
+
+func TestLoadConcordancePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"default":{"authorities":["FactSet","TME"]},"conceptTypes":{"Location":{"transfers":[{"from":"ManagedLocation","to":"*"}]}}}`), 0600))
+
+	policy, err := LoadConcordancePolicy(path)
+	assert.NoError(t, err)
+	assert.Equal(t, ConcordancePolicy{
+		Default:      ConcordanceRule{Authorities: []string{"FactSet", "TME"}},
+		ConceptTypes: map[string]ConcordanceRule{"Location": {Transfers: []ConcordanceTransfer{{From: "ManagedLocation", To: AnyAuthority}}}},
+	}, policy)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"conceptTypes":{"Location":{"transfers":[{"from":"ManagedLocation"}]}}}`), 0600))
+	_, err = LoadConcordancePolicy(path)
+	assert.EqualError(t, err, `invalid concordance policy file `+path+`: rule of Location: transfer {From:ManagedLocation To:} needs both an authority from and to`)
+}
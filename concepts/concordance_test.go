@@ -0,0 +1,36 @@
+package concepts
+
+import (
+	"testing"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutSources(t *testing.T) {
+	source := func(uuid string) ontology.SourceConcept {
+		return ontology.SourceConcept{SourceConceptFields: ontology.SourceConceptFields{UUID: uuid}}
+	}
+	concept := ontology.CanonicalConcept{
+		CanonicalConceptFields: ontology.CanonicalConceptFields{
+			PrefUUID:              "uuid-1",
+			AggregatedHash:        "123",
+			SourceRepresentations: []ontology.SourceConcept{source("uuid-1"), source("uuid-2"), source("uuid-3")},
+		},
+	}
+
+	updated, err := withoutSources(concept, []string{"uuid-3", "uuid-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []ontology.SourceConcept{source("uuid-1")}, updated.SourceRepresentations)
+	assert.Empty(t, updated.AggregatedHash, "The aggregate hash should be worked out again")
+	assert.Len(t, concept.SourceRepresentations, 3, "The concept should not be modified")
+
+	_, err = withoutSources(concept, []string{"uuid-2", "uuid-4"})
+	assert.EqualError(t, err, "uuid-4 is not a source of concept uuid-1")
+	_, err = withoutSources(concept, []string{"uuid-1"})
+	assert.EqualError(t, err, "uuid-1 is the prefUUID of the concept and cannot be unconcorded")
+
+	concept.PrefUUID = "canonical-1"
+	_, err = withoutSources(concept, []string{"uuid-1", "uuid-2", "uuid-3"})
+	assert.EqualError(t, err, "cannot unconcord all the sources of concept canonical-1, delete it instead")
+}
@@ -0,0 +1,70 @@
+package concepts
+
+import (
+	"context"
+	"sync"
+)
+
+type mockConflictStore struct {
+	mu        sync.Mutex
+	conflicts []ConcordanceConflict
+	err       error
+}
+
+func newMockConflictStore(conflicts ...ConcordanceConflict) *mockConflictStore {
+	return &mockConflictStore{conflicts: conflicts}
+}
+
+func (m *mockConflictStore) AddConflict(_ context.Context, conflict ConcordanceConflict) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	for i, c := range m.conflicts {
+		if c.ID == conflict.ID {
+			conflict.FirstSeen = c.FirstSeen
+			conflict.Occurrences = c.Occurrences + 1
+			m.conflicts[i] = conflict
+			return nil
+		}
+	}
+	m.conflicts = append(m.conflicts, conflict)
+	return nil
+}
+
+func (m *mockConflictStore) Conflicts(_ context.Context, filter ConflictFilter) ([]ConcordanceConflict, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	conflicts := []ConcordanceConflict{}
+	for i := len(m.conflicts) - 1; i >= 0; i-- {
+		c := m.conflicts[i]
+		if filter.ConceptType != "" && c.Incoming.Type != filter.ConceptType {
+			continue
+		}
+		if filter.PrefUUID != "" && c.Existing.PrefUUID != filter.PrefUUID && c.Incoming.PrefUUID != filter.PrefUUID {
+			continue
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, nil
+}
+
+func (m *mockConflictStore) ResolveConflicts(_ context.Context, prefUUID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	var conflicts []ConcordanceConflict
+	for _, c := range m.conflicts {
+		if c.Incoming.PrefUUID != prefUUID {
+			conflicts = append(conflicts, c)
+		}
+	}
+	m.conflicts = conflicts
+	return nil
+}
@@ -0,0 +1,309 @@
+package concepts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+)
+
+// ConceptSummary describes a canonical concept taking part in a concordance conflict
+type ConceptSummary struct {
+	PrefUUID    string   `json:"prefUUID"`
+	PrefLabel   string   `json:"prefLabel,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Authority   string   `json:"authority,omitempty"`
+	SourceUUIDs []string `json:"sourceUUIDs,omitempty"`
+}
+
+func summarise(concept ontology.CanonicalConcept) ConceptSummary {
+	summary := ConceptSummary{
+		PrefUUID:  concept.PrefUUID,
+		PrefLabel: concept.PrefLabel,
+		Type:      concept.Type,
+		Authority: concept.GetCanonicalAuthority(),
+	}
+	for _, source := range concept.SourceRepresentations {
+		summary.SourceUUIDs = append(summary.SourceUUIDs, source.UUID)
+	}
+	return summary
+}
+
+// ConcordanceConflict is a write that was rejected because one of its sources is the prefUUID of another concordance
+// which the concordance policy does not allow it to take over. A conflict is kept until the incoming concept is written.
+type ConcordanceConflict struct {
+	// ID is made of the prefUUID of the incoming concept and the uuid of the source
+	ID            string    `json:"id"`
+	SourceUUID    string    `json:"sourceUUID"`
+	TransactionID string    `json:"transactionID"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+	// Occurrences counts the rejected writes of the incoming concept with the source
+	Occurrences int            `json:"occurrences"`
+	Existing    ConceptSummary `json:"existing"`
+	Incoming    ConceptSummary `json:"incoming"`
+}
+
+// ConcordanceConflictError is returned by a write rejected because of a concordance conflict
+type ConcordanceConflictError struct {
+	Conflict ConcordanceConflict
+}
+
+func (e *ConcordanceConflictError) Error() string {
+	return fmt.Sprintf("Cannot currently process this record as it will break an existing concordance with prefUuid: %s", e.Conflict.SourceUUID)
+}
+
+// IncompleteTransferError is returned by a forced transfer of a concordance which leaves out some of its sources, as
+// they would be left without a canonical node
+type IncompleteTransferError struct {
+	PrefUUID       string
+	MissingSources []string
+}
+
+func (e *IncompleteTransferError) Error() string {
+	return fmt.Sprintf("Cannot take over the concordance with prefUuid: %s without its sources: %s", e.PrefUUID, strings.Join(e.MissingSources, ", "))
+}
+
+// ConflictFilter narrows down the conflicts returned by a ConflictStore, empty fields matching every conflict
+type ConflictFilter struct {
+	ConceptType string
+	// PrefUUID matches the conflicts of both the existing and the incoming concept
+	PrefUUID string
+}
+
+// ConflictStore keeps the concordance conflicts until they are resolved
+type ConflictStore interface {
+	// AddConflict stores the conflict, counting it as another occurrence if it is already stored
+	AddConflict(ctx context.Context, conflict ConcordanceConflict) error
+	// Conflicts returns the conflicts matching the filter, the latest seen first
+	Conflicts(ctx context.Context, filter ConflictFilter) ([]ConcordanceConflict, error)
+	// ResolveConflicts removes the conflicts of the incoming concept with the prefUUID
+	ResolveConflicts(ctx context.Context, prefUUID string) error
+}
+
+// resolveQuerier is implemented by the stores whose conflicts can be resolved in the same transaction as the concept
+type resolveQuerier interface {
+	resolveQuery(prefUUID string) *cmneo4j.Query
+}
+
+// WithConflictReport stores the concordance conflicts rejecting writes, and resolves them once the incoming concept is
+// written
+func WithConflictReport(store ConflictStore) ServiceOption {
+	return func(s *ConceptService) {
+		s.conflicts = store
+	}
+}
+
+// concordanceConflict returns the error rejecting the write of the concept whose source is the prefUUID of another
+// concordance, read to report both concepts
+func (s *ConceptService) concordanceConflict(ctx context.Context, sourceUUID, authority string, concept ontology.CanonicalConcept, transID string) error {
+	conflict := ConcordanceConflict{
+		ID:            concept.PrefUUID + ":" + sourceUUID,
+		SourceUUID:    sourceUUID,
+		TransactionID: transID,
+		Existing:      ConceptSummary{PrefUUID: sourceUUID, Authority: authority},
+		Incoming:      summarise(concept),
+	}
+	if s.conflicts != nil {
+		existing, found, err := s.read(ctx, sourceUUID, transID)
+		if err != nil {
+			s.log.WithError(err).WithTransactionID(transID).WithUUID(concept.PrefUUID).Warnf("Could not read the concept %s conflicting with the write", sourceUUID)
+		} else if found {
+			conflict.Existing = summarise(existing)
+		}
+	}
+	return &ConcordanceConflictError{Conflict: conflict}
+}
+
+// recordConflict stores the conflict rejecting a write, failing to do so being only logged as the write failed anyway
+func (s *ConceptService) recordConflict(ctx context.Context, err error, transID string) {
+	var conflictErr *ConcordanceConflictError
+	if s.conflicts == nil || !errors.As(err, &conflictErr) {
+		return
+	}
+	conflict := conflictErr.Conflict
+	conflict.FirstSeen = time.Now().UTC()
+	conflict.LastSeen = conflict.FirstSeen
+	conflict.Occurrences = 1
+	if err := s.conflicts.AddConflict(ctx, conflict); err != nil {
+		s.log.WithError(err).WithTransactionID(transID).WithUUID(conflict.Incoming.PrefUUID).Error("Could not record the concordance conflict")
+	}
+}
+
+// Neo4jConflictStore keeps the conflicts as ConcordanceConflict nodes
+type Neo4jConflictStore struct {
+	driver  *cmneo4j.Driver
+	queries queryLimiter
+}
+
+// NewNeo4jConflictStore returns a store keeping the conflicts in Neo4j
+func NewNeo4jConflictStore(driver *cmneo4j.Driver) *Neo4jConflictStore {
+	return &Neo4jConflictStore{driver: driver, queries: newQueryLimiter(defaultMaxConcurrentQueries)}
+}
+
+// Initialise creates the constraint of the conflict nodes and the index of their incoming prefUUID, looked up on every
+// write, if they are not already created.
+func (s *Neo4jConflictStore) Initialise() error {
+	if err := s.driver.EnsureConstraints(map[string]string{
+		"ConcordanceConflict": "id",
+	}); err != nil {
+		return err
+	}
+	return s.driver.EnsureIndexes(map[string]string{
+		"ConcordanceConflict": "incomingPrefUUID",
+	})
+}
+
+func (s *Neo4jConflictStore) AddConflict(ctx context.Context, conflict ConcordanceConflict) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	existing, err := json.Marshal(conflict.Existing)
+	if err != nil {
+		return err
+	}
+	incoming, err := json.Marshal(conflict.Incoming)
+	if err != nil {
+		return err
+	}
+	return s.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			MERGE (c:ConcordanceConflict {id:$id})
+			ON CREATE SET c.firstSeen = $seen, c.occurrences = 0
+			SET c += $conflict, c.lastSeen = $seen, c.occurrences = c.occurrences + 1`,
+		Params: map[string]interface{}{
+			"id":   conflict.ID,
+			"seen": conflict.LastSeen.UnixMilli(),
+			"conflict": map[string]interface{}{
+				"sourceUUID":       conflict.SourceUUID,
+				"transactionID":    conflict.TransactionID,
+				"type":             conflict.Incoming.Type,
+				"existingPrefUUID": conflict.Existing.PrefUUID,
+				"incomingPrefUUID": conflict.Incoming.PrefUUID,
+				"existing":         string(existing),
+				"incoming":         string(incoming),
+			},
+		},
+	})
+}
+
+type conflictResult struct {
+	ID            string `json:"id"`
+	SourceUUID    string `json:"sourceUUID"`
+	TransactionID string `json:"transactionID"`
+	FirstSeen     int64  `json:"firstSeen"`
+	LastSeen      int64  `json:"lastSeen"`
+	Occurrences   int    `json:"occurrences"`
+	Existing      string `json:"existing"`
+	Incoming      string `json:"incoming"`
+}
+
+func (r conflictResult) conflict() (ConcordanceConflict, error) {
+	conflict := ConcordanceConflict{
+		ID:            r.ID,
+		SourceUUID:    r.SourceUUID,
+		TransactionID: r.TransactionID,
+		FirstSeen:     time.UnixMilli(r.FirstSeen).UTC(),
+		LastSeen:      time.UnixMilli(r.LastSeen).UTC(),
+		Occurrences:   r.Occurrences,
+	}
+	if err := json.Unmarshal([]byte(r.Existing), &conflict.Existing); err != nil {
+		return ConcordanceConflict{}, fmt.Errorf("decoding the existing concept of conflict %s: %w", r.ID, err)
+	}
+	if err := json.Unmarshal([]byte(r.Incoming), &conflict.Incoming); err != nil {
+		return ConcordanceConflict{}, fmt.Errorf("decoding the incoming concept of conflict %s: %w", r.ID, err)
+	}
+	return conflict, nil
+}
+
+func (s *Neo4jConflictStore) Conflicts(ctx context.Context, filter ConflictFilter) ([]ConcordanceConflict, error) {
+	var result []conflictResult
+	err := s.queries.run(ctx, func() error {
+		return s.driver.Read(&cmneo4j.Query{
+			Cypher: `
+				MATCH (c:ConcordanceConflict)
+				WHERE ($type = "" OR c.type = $type)
+					AND ($prefUUID = "" OR c.existingPrefUUID = $prefUUID OR c.incomingPrefUUID = $prefUUID)
+				RETURN c.id AS id, c.sourceUUID AS sourceUUID, c.transactionID AS transactionID, c.firstSeen AS firstSeen,
+					c.lastSeen AS lastSeen, c.occurrences AS occurrences, c.existing AS existing, c.incoming AS incoming
+				ORDER BY lastSeen DESC`,
+			Params: map[string]interface{}{
+				"type":     filter.ConceptType,
+				"prefUUID": filter.PrefUUID,
+			},
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return []ConcordanceConflict{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	conflicts := make([]ConcordanceConflict, 0, len(result))
+	for _, r := range result {
+		conflict, err := r.conflict()
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts, nil
+}
+
+func (s *Neo4jConflictStore) ResolveConflicts(ctx context.Context, prefUUID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.driver.Write(s.resolveQuery(prefUUID))
+}
+
+func (s *Neo4jConflictStore) resolveQuery(prefUUID string) *cmneo4j.Query {
+	return &cmneo4j.Query{
+		Cypher: `
+			MATCH (c:ConcordanceConflict {incomingPrefUUID:$prefUUID})
+			DELETE c`,
+		Params: map[string]interface{}{
+			"prefUUID": prefUUID,
+		},
+	}
+}
+
+// GetConflicts lists the unresolved concordance conflicts, optionally of a concept type or concept
+func (h *ConceptsHandler) GetConflicts(w http.ResponseWriter, r *http.Request) {
+	if !h.conflictsEnabled(w, r) {
+		return
+	}
+	filter := ConflictFilter{
+		ConceptType: r.URL.Query().Get("type"),
+		PrefUUID:    r.URL.Query().Get("prefUUID"),
+	}
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	conflicts, err := h.Conflicts.Conflicts(ctx, filter)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, conflicts)
+}
+
+// conflictsEnabled sets the response headers and fails the request when no conflict store is configured
+func (h *ConceptsHandler) conflictsEnabled(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transactionidutils.GetTransactionIDFromRequest(r))
+
+	if h.Conflicts == nil {
+		writeJSONError(w, "the concordance conflict report is not enabled", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
@@ -1,13 +1,17 @@
 package concepts
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
 
@@ -30,14 +34,100 @@ var irregularConceptTypePaths = map[string]string{
 
 type ConceptsHandler struct {
 	ConceptsService ConceptServicer
+	// BulkConcurrency is the number of concepts written in parallel by the bulk endpoint
+	BulkConcurrency int
+	// BulkMaxBodySize is the largest body in bytes accepted by the bulk endpoint, zero meaning no limit
+	BulkMaxBodySize int64
+	// ReadTimeout, WriteTimeout and DeleteTimeout limit how long each operation can take, zero meaning no limit
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	DeleteTimeout time.Duration
+	// ChangesPollInterval is how often the change feed looks for new events, defaulting to a second
+	ChangesPollInterval time.Duration
+	// ChangesSettleLag is how long after being written events are read again by the change feed, in case writes that
+	// started earlier commit after them, defaulting to 35 seconds
+	ChangesSettleLag time.Duration
+	// Subscriptions keeps the webhook subscriptions, the /__subscriptions endpoints being disabled when it is nil
+	Subscriptions SubscriptionStore
+	// WebhookHosts are the hosts webhooks can be registered for, a host starting with "*." allowing all its subdomains
+	WebhookHosts []string
+	// Versions keeps the version history of the concepts, the history endpoints being disabled when it is nil
+	Versions VersionStore
+	// Conflicts keeps the concordance conflicts, the /__conflicts endpoint being disabled when it is nil
+	Conflicts ConflictStore
+	// ConcordancePolicy is the policy of the concepts service, returned by /__config/concordance-policy
+	ConcordancePolicy *ConcordancePolicy
 }
 
 func (h *ConceptsHandler) RegisterHandlers(router *mux.Router) {
+	router.Handle("/bulk/concepts", handlers.MethodHandler{
+		"POST": http.HandlerFunc(h.BulkWriteConcepts),
+	})
+	router.Handle("/lookup", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.LookupConcept),
+	})
+	router.Handle("/__config/concordance-policy", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetConcordancePolicy),
+	})
+	router.Handle("/__conflicts", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetConflicts),
+	})
+	router.Handle("/__stats", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetStats),
+	})
+	router.Handle("/__changes/stream", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.StreamChanges),
+	})
+	router.Handle("/__subscriptions", handlers.MethodHandler{
+		"GET":  http.HandlerFunc(h.ListSubscriptions),
+		"POST": http.HandlerFunc(h.CreateSubscription),
+	})
+	router.Handle("/__subscriptions/{id}", handlers.MethodHandler{
+		"GET":    http.HandlerFunc(h.GetSubscription),
+		"PUT":    http.HandlerFunc(h.PutSubscription),
+		"DELETE": http.HandlerFunc(h.DeleteSubscription),
+	})
+	router.Handle("/__subscriptions/{id}/dead-letters", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetDeadLetters),
+	})
+	router.Handle("/organisations/by-lei/{value}", handlers.MethodHandler{
+		"GET": h.lookupConceptByIdentifier(LEIIdentifier, "LEI"),
+	})
+	router.Handle("/financial-instruments/by-figi/{value}", handlers.MethodHandler{
+		"GET": h.lookupConceptByIdentifier(FIGIIdentifier, "FIGI"),
+	})
+	router.Handle("/locations/by-iso31661/{value}", handlers.MethodHandler{
+		"GET": h.lookupConceptByIdentifier(ISO31661Identifier, "ISO 3166-1 code"),
+	})
+	router.Handle("/{concept_type}/__count", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.CountConcepts),
+	})
+	router.Handle("/{concept_type}/{uuid}/history", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetHistory),
+	})
+	router.Handle("/{concept_type}/{uuid}/versions/{hash}", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetVersion),
+	})
+	router.Handle("/{concept_type}/{uuid}/concordance", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.GetConcordance),
+	})
+	router.Handle("/{concept_type}/{uuid}/unconcord", handlers.MethodHandler{
+		"POST": http.HandlerFunc(h.UnconcordConcept),
+	})
+	router.Handle("/{concept_type}/{uuid}/merge", handlers.MethodHandler{
+		"POST": http.HandlerFunc(h.MergeConcept),
+	})
+	router.Handle("/{concept_type}/{uuid}/rollback", handlers.MethodHandler{
+		"POST": http.HandlerFunc(h.RollbackConcept),
+	})
 	router.Handle("/{concept_type}/{uuid}", handlers.MethodHandler{
 		"GET":    http.HandlerFunc(h.GetConcept),
 		"PUT":    http.HandlerFunc(h.PutConcept),
 		"DELETE": http.HandlerFunc(h.DeleteConcept),
 	})
+	router.Handle("/{concept_type}", handlers.MethodHandler{
+		"GET": http.HandlerFunc(h.ListConcepts),
+	})
 }
 
 func (h *ConceptsHandler) PutConcept(w http.ResponseWriter, r *http.Request) {
@@ -69,21 +159,43 @@ func (h *ConceptsHandler) PutConcept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updatedIds, err := h.ConceptsService.Write(inst, transID)
+	ctx, cancel := withTimeout(r.Context(), h.WriteTimeout)
+	defer cancel()
+	h.writeConcept(ctx, w, r, inst, transID)
+}
+
+// writeConcept writes the concept, or previews the write with ?dryRun=true, and responds with its changes
+func (h *ConceptsHandler) writeConcept(ctx context.Context, w http.ResponseWriter, r *http.Request, inst interface{}, transID string) {
+	opts := WriteOptions{IfMatch: parseETags(r.Header.Get("If-Match")), Author: r.Header.Get(AuthorHeader)}
+	switch force := r.URL.Query().Get("force"); force {
+	case "":
+	case "transfer":
+		opts.TransferConcordance = true
+	default:
+		writeJSONError(w, fmt.Sprintf("unknown force option %q, only transfer is supported", force), http.StatusBadRequest)
+		return
+	}
+	var updatedIds interface{}
+	var err error
+	if r.URL.Query().Get("dryRun") == "true" {
+		updatedIds, err = h.ConceptsService.Preview(ctx, inst, transID, opts)
+	} else {
+		updatedIds, err = h.ConceptsService.Write(ctx, inst, transID, opts)
+	}
 
 	if err != nil {
-		switch e := err.(type) {
-		case noContentReturnedError:
-			writeJSONError(w, e.NoContentReturnedDetails(), http.StatusNoContent)
-			return
-		case rwapi.ConstraintOrTransactionError:
-			writeJSONError(w, e.Error(), http.StatusConflict)
-			return
-		case invalidRequestError:
-			writeJSONError(w, e.InvalidRequestDetails(), http.StatusBadRequest)
+		statusCode, msg := writeErrorStatus(err)
+		writeJSONError(w, msg, statusCode)
+		return
+	}
+
+	if acceptsCloudEvents(r) {
+		switch changes := updatedIds.(type) {
+		case ConceptChanges:
+			writeCloudEvents(w, changes.ChangedRecords)
 			return
-		default:
-			writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		case WritePreview:
+			writeCloudEvents(w, changes.ChangedRecords)
 			return
 		}
 	}
@@ -95,7 +207,6 @@ func (h *ConceptsHandler) PutConcept(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(updateIDsBody)
-	return
 }
 
 func (h *ConceptsHandler) GetConcept(w http.ResponseWriter, r *http.Request) {
@@ -105,16 +216,48 @@ func (h *ConceptsHandler) GetConcept(w http.ResponseWriter, r *http.Request) {
 
 	transID := transactionidutils.GetTransactionIDFromRequest(r)
 
-	obj, found, err := h.ConceptsService.Read(uuid, transID)
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	obj, found, err := h.ConceptsService.Read(ctx, uuid, transID)
 
 	w.Header().Add("Content-Type", "application/json")
 	w.Header().Set("X-Request-Id", transID)
 
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
 		return
 	}
 
+	if !found && r.URL.Query().Get("resolve") != "false" {
+		// the uuid may be one of the source concepts, in which case the client is sent to the canonical concept. The
+		// redirect is a 307 rather than a permanent 301 so that it is not cached, as the source can later be concorded to
+		// another concept. A canonical concept of another type is not found under this path, so it is not redirected to.
+		prefUUID, resolved, err := h.ConceptsService.ResolvePrefUUID(ctx, uuid, transID)
+		var ambiguous ambiguousLookupError
+		if errors.As(err, &ambiguous) {
+			writeJSONError(w, ErrAmbiguousLookup.Error(), http.StatusConflict, ambiguous.prefUUIDs...)
+			return
+		}
+		if err != nil {
+			writeJSONError(w, err.Error(), serviceErrorStatus(err))
+			return
+		}
+		if resolved && prefUUID != uuid {
+			canonical, canonicalFound, err := h.ConceptsService.Read(ctx, prefUUID, transID)
+			if err != nil {
+				writeJSONError(w, err.Error(), serviceErrorStatus(err))
+				return
+			}
+			if !canonicalFound || checkConceptTypeAgainstPath(canonical.(ontology.CanonicalConcept).Type, conceptType) != nil {
+				writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound)
+				return
+			}
+			location := url.URL{Path: fmt.Sprintf("/%s/%s", conceptType, prefUUID), RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, location.String(), http.StatusTemporaryRedirect)
+			return
+		}
+	}
+
 	if !found {
 		writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound)
 		return
@@ -126,6 +269,180 @@ func (h *ConceptsHandler) GetConcept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if agConcept.AggregatedHash != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", agConcept.AggregatedHash))
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(obj); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetConcordance returns the canonical node of the concept with its sources and their incoming relationships, showing
+// what prevents the concept from being deleted
+func (h *ConceptsHandler) GetConcordance(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	graph, found, err := h.ConceptsService.ReadConcordance(ctx, uuid, transID)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Concept with UUID %s not found in db.", uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err := checkConceptTypeAgainstPath(graph.Canonical.Type, vars["concept_type"]); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+	writeJSON(w, http.StatusOK, graph)
+}
+
+// ListConcepts returns a page of the canonical concepts whose type matches the path
+func (h *ConceptsHandler) ListConcepts(w http.ResponseWriter, r *http.Request) {
+	conceptType := mux.Vars(r)["concept_type"]
+	query := r.URL.Query()
+
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	types := conceptTypesForPath(conceptType)
+	if len(types) == 0 {
+		writeJSONError(w, fmt.Sprintf("unknown concept type %s", conceptType), http.StatusNotFound)
+		return
+	}
+
+	opts := ListOptions{Types: types, Cursor: query.Get("cursor"), Limit: DefaultListLimit}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > MaxListLimit {
+			writeJSONError(w, fmt.Sprintf("limit must be a number between 1 and %d", MaxListLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = l
+	}
+	opts.Fields = splitList(query.Get("fields"))
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	list, err := h.ConceptsService.List(ctx, opts, transID)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(list); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetStats returns the counts of stored concepts for every concept type
+func (h *ConceptsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	h.writeStats(w, r, ontology.GetConfig().GetConceptTypes())
+}
+
+// CountConcepts returns the counts of stored concepts for the concept types matching the path
+func (h *ConceptsHandler) CountConcepts(w http.ResponseWriter, r *http.Request) {
+	conceptType := mux.Vars(r)["concept_type"]
+	types := conceptTypesForPath(conceptType)
+	if len(types) == 0 {
+		w.Header().Add("Content-Type", "application/json")
+		writeJSONError(w, fmt.Sprintf("unknown concept type %s", conceptType), http.StatusNotFound)
+		return
+	}
+	h.writeStats(w, r, types)
+}
+
+func (h *ConceptsHandler) writeStats(w http.ResponseWriter, r *http.Request, types []string) {
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	stats, err := h.ConceptsService.Stats(ctx, types, transID)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(stats); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// LookupConcept returns the canonical concept of the source concept identified by the authority and authorityValue query parameters
+func (h *ConceptsHandler) LookupConcept(w http.ResponseWriter, r *http.Request) {
+	authority := r.URL.Query().Get("authority")
+	authorityValue := r.URL.Query().Get("authorityValue")
+
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	if authority == "" || authorityValue == "" {
+		writeJSONError(w, "authority and authorityValue query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	obj, found, err := h.ConceptsService.LookupByAuthority(ctx, authority, authorityValue, transID)
+	writeLookupResult(w, obj, found, err, fmt.Sprintf("Concept with authority %s and authorityValue %s not found in db.", authority, authorityValue))
+}
+
+// lookupConceptByIdentifier returns a handler for the canonical concept holding the identifier value in the path
+func (h *ConceptsHandler) lookupConceptByIdentifier(identifier, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := mux.Vars(r)["value"]
+
+		transID := transactionidutils.GetTransactionIDFromRequest(r)
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", transID)
+
+		ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+		defer cancel()
+		obj, found, err := h.ConceptsService.LookupByIdentifier(ctx, identifier, value, transID)
+		writeLookupResult(w, obj, found, err, fmt.Sprintf("Concept with %s %s not found in db.", name, value))
+	})
+}
+
+// writeLookupResult writes the canonical concept an identifier resolved to, or the reason it could not be resolved.
+func writeLookupResult(w http.ResponseWriter, obj interface{}, found bool, err error, notFoundMsg string) {
+	var ambiguous ambiguousLookupError
+	if errors.As(err, &ambiguous) {
+		writeJSONError(w, ErrAmbiguousLookup.Error(), http.StatusConflict, ambiguous.prefUUIDs...)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+	if !found {
+		writeJSONError(w, notFoundMsg, http.StatusNotFound)
+		return
+	}
+
+	agConcept := obj.(ontology.CanonicalConcept)
+	if agConcept.AggregatedHash != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", agConcept.AggregatedHash))
+	}
+
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(obj); err != nil {
 		writeJSONError(w, err.Error(), http.StatusInternalServerError)
@@ -142,10 +459,13 @@ func (h *ConceptsHandler) DeleteConcept(w http.ResponseWriter, r *http.Request)
 	w.Header().Add("Content-Type", "application/json")
 	w.Header().Set("X-Request-Id", transID)
 
+	ctx, cancel := withTimeout(r.Context(), h.DeleteTimeout)
+	defer cancel()
+
 	// Validate that the concept exists and is of the right type.
-	obj, found, err := h.ConceptsService.Read(uuid, transID)
+	obj, found, err := h.ConceptsService.Read(ctx, uuid, transID)
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusServiceUnavailable, uuid)
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
 		return
 	}
 	if !found {
@@ -159,7 +479,8 @@ func (h *ConceptsHandler) DeleteConcept(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Delete the concept
-	affected, err := h.ConceptsService.Delete(uuid, transID)
+	changes, err := h.ConceptsService.Delete(ctx, uuid, transID)
+	affected := changes.UpdatedIds
 	if errors.Is(err, ErrNotFound) {
 		writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound, uuid)
 		return
@@ -173,13 +494,19 @@ func (h *ConceptsHandler) DeleteConcept(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusServiceUnavailable, uuid)
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+
+	if acceptsCloudEvents(r) {
+		writeCloudEvents(w, changes.ChangedRecords, uuid)
 		return
 	}
 
 	resp := struct {
-		UUIDS []string `json:"uuids"`
-	}{affected}
+		UUIDS  []string `json:"uuids"`
+		Events []Event  `json:"events"`
+	}{affected, changes.ChangedRecords}
 
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(resp); err != nil {
@@ -188,6 +515,183 @@ func (h *ConceptsHandler) DeleteConcept(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// UnconcordConcept detaches the sources listed in the body from the canonical concept
+func (h *ConceptsHandler) UnconcordConcept(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+	conceptType := vars["concept_type"]
+
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	var body struct {
+		UUIDs []string `json:"uuids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+	if len(body.UUIDs) == 0 {
+		writeJSONError(w, "uuids of the sources to unconcord are required", http.StatusBadRequest, uuid)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), h.WriteTimeout)
+	defer cancel()
+
+	// Validate that the concept exists and is of the right type.
+	obj, found, err := h.ConceptsService.Read(ctx, uuid, transID)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err := checkConceptTypeAgainstPath(obj.(ontology.CanonicalConcept).Type, conceptType); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+
+	opts := WriteOptions{IfMatch: parseETags(r.Header.Get("If-Match")), Author: r.Header.Get(AuthorHeader)}
+	changes, err := h.ConceptsService.Unconcord(ctx, uuid, body.UUIDs, transID, opts)
+	if errors.Is(err, ErrNotFound) {
+		writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err != nil {
+		statusCode, msg := writeErrorStatus(err)
+		writeJSONError(w, msg, statusCode, uuid)
+		return
+	}
+
+	if acceptsCloudEvents(r) {
+		writeCloudEvents(w, changes.ChangedRecords, uuid)
+		return
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// MergeConcept moves every source of the canonical concept whose prefUUID is given in the body onto this one
+func (h *ConceptsHandler) MergeConcept(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+	conceptType := vars["concept_type"]
+
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	var body struct {
+		PrefUUID     string `json:"prefUUID"`
+		SupersededBy bool   `json:"supersededBy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+	if body.PrefUUID == "" {
+		writeJSONError(w, "prefUUID of the concept to merge is required", http.StatusBadRequest, uuid)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), h.WriteTimeout)
+	defer cancel()
+
+	// Validate that the concept exists and is of the right type.
+	obj, found, err := h.ConceptsService.Read(ctx, uuid, transID)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err := checkConceptTypeAgainstPath(obj.(ontology.CanonicalConcept).Type, conceptType); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+
+	opts := MergeOptions{
+		WriteOptions: WriteOptions{IfMatch: parseETags(r.Header.Get("If-Match")), Author: r.Header.Get(AuthorHeader)},
+		SupersededBy: body.SupersededBy,
+	}
+	changes, err := h.ConceptsService.Merge(ctx, uuid, body.PrefUUID, transID, opts)
+	if errors.Is(err, ErrNotFound) {
+		writeJSONError(w, fmt.Sprintf("Concept with prefUUID %s not found in db.", uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err != nil {
+		statusCode, msg := writeErrorStatus(err)
+		writeJSONError(w, msg, statusCode, uuid, body.PrefUUID)
+		return
+	}
+
+	if acceptsCloudEvents(r) {
+		writeCloudEvents(w, changes.ChangedRecords, uuid)
+		return
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// writeErrorStatus maps an error returned by a concept write to the response status code and message.
+func writeErrorStatus(err error) (int, string) {
+	if errors.Is(err, ErrPreconditionFailed) {
+		return http.StatusPreconditionFailed, err.Error()
+	}
+	var conflict *ConcordanceConflictError
+	var incomplete *IncompleteTransferError
+	if errors.As(err, &conflict) || errors.As(err, &incomplete) {
+		return http.StatusConflict, err.Error()
+	}
+
+	switch e := err.(type) {
+	case noContentReturnedError:
+		return http.StatusNoContent, e.NoContentReturnedDetails()
+	case rwapi.ConstraintOrTransactionError:
+		return http.StatusConflict, e.Error()
+	case invalidRequestError:
+		return http.StatusBadRequest, e.InvalidRequestDetails()
+	default:
+		return serviceErrorStatus(err), err.Error()
+	}
+}
+
+// serviceErrorStatus returns the status code for an unexpected error from the concepts service
+func serviceErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusServiceUnavailable
+}
+
+// withTimeout derives a context for a single operation, a timeout of zero meaning no limit
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// parseETags returns the entity tags listed in an If-Match header value, without their quotes.
+func parseETags(header string) []string {
+	var etags []string
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "" {
+			continue
+		}
+		if etag != "*" {
+			etag = strings.Trim(etag, `"`)
+		}
+		etags = append(etags, etag)
+	}
+	return etags
+}
+
 type errorResponse struct {
 	Message string   `json:"message,omitempty"`
 	UUIDs   []string `json:"uuids,omitempty"`
@@ -202,6 +706,14 @@ func writeJSONError(w http.ResponseWriter, errorMsg string, statusCode int, uuid
 	}
 }
 
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.WriteHeader(statusCode)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(body); err != nil {
+		return
+	}
+}
+
 func checkConceptTypeAgainstPath(conceptType, path string) error {
 	if iPath, ok := irregularConceptTypePaths[conceptType]; ok && iPath != "" {
 		if iPath != path {
@@ -216,6 +728,17 @@ func checkConceptTypeAgainstPath(conceptType, path string) error {
 	return nil
 }
 
+// conceptTypesForPath returns the concept types whose path is the given one
+func conceptTypesForPath(path string) []string {
+	var types []string
+	for _, conceptType := range ontology.GetConfig().GetConceptTypes() {
+		if checkConceptTypeAgainstPath(conceptType, path) == nil {
+			types = append(types, conceptType)
+		}
+	}
+	return types
+}
+
 var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
 var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
 
@@ -1,12 +1,17 @@
 package concepts
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
 
@@ -21,6 +26,7 @@ const knownUUID = "12345"
 
 func TestDeleteHandler(t *testing.T) {
 	assert := assert.New(t)
+	deletedDummyEvents := []Event{{ConceptType: "Dummy", ConceptUUID: knownUUID, AggregateHash: "123", TransactionID: "tid_1", EventDetails: ConceptEvent{Type: DeletedEvent}}}
 	tests := []struct {
 		name       string
 		req        *http.Request
@@ -37,12 +43,12 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{knownUUID}, nil
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{ChangedRecords: deletedDummyEvents, UpdatedIds: []string{knownUUID}}, nil
 				},
 			},
 			statusCode: http.StatusOK,
-			body:       deleteSuccess(knownUUID),
+			body:       deleteSuccess(deletedDummyEvents, knownUUID),
 		},
 		{
 			name: "IrregularPathFailure",
@@ -53,8 +59,8 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{}, nil
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, nil
 				},
 			},
 			statusCode: http.StatusBadRequest,
@@ -69,12 +75,12 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Location"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{knownUUID}, nil
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{UpdatedIds: []string{knownUUID}}, nil
 				},
 			},
 			statusCode: http.StatusOK,
-			body:       deleteSuccess(knownUUID),
+			body:       deleteSuccess(nil, knownUUID),
 		},
 		{
 			name: "RegularPathFailure",
@@ -85,8 +91,8 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Location"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{}, nil
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, nil
 				},
 			},
 			statusCode: http.StatusBadRequest,
@@ -99,8 +105,8 @@ func TestDeleteHandler(t *testing.T) {
 				read: func(uuid string, transID string) (interface{}, bool, error) {
 					return nil, false, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{}, ErrNotFound
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, ErrNotFound
 				},
 			},
 			statusCode: http.StatusNotFound,
@@ -113,8 +119,8 @@ func TestDeleteHandler(t *testing.T) {
 				read: func(uuid string, transID string) (interface{}, bool, error) {
 					return nil, false, errors.New("TEST failing to READ")
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{}, nil
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, nil
 				},
 			},
 			statusCode: http.StatusServiceUnavailable,
@@ -129,13 +135,29 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{}, errors.New("TEST failing to DELETE")
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, errors.New("TEST failing to DELETE")
 				},
 			},
 			statusCode: http.StatusServiceUnavailable,
 			body:       errorMessage("TEST failing to DELETE", knownUUID),
 		},
+		{
+			name: "DeleteTimedOut",
+			req:  newRequest("DELETE", fmt.Sprintf("/dummies/%s", knownUUID), t),
+			ds: &mockConceptService{
+				read: func(uuid string, transID string) (interface{}, bool, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, true, nil
+				},
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, context.DeadlineExceeded
+				},
+			},
+			statusCode: http.StatusGatewayTimeout,
+			body:       errorMessage(context.DeadlineExceeded.Error(), knownUUID),
+		},
 		{
 			name: "BadConceptType",
 			req:  newRequest("DELETE", fmt.Sprintf("/dummies/%s", knownUUID), t),
@@ -145,8 +167,8 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "not-dummy"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{}, nil
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{}, nil
 				},
 			},
 			statusCode: http.StatusBadRequest,
@@ -161,8 +183,8 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{"uuid1", "uuid2"}, ErrDeleteRelated
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{UpdatedIds: []string{"uuid1", "uuid2"}}, ErrDeleteRelated
 				},
 			},
 			statusCode: http.StatusBadRequest,
@@ -177,8 +199,8 @@ func TestDeleteHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, true, nil
 				},
-				delete: func(uuid string, transID string) ([]string, error) {
-					return []string{"uuid1"}, ErrDeleteSource
+				delete: func(uuid string, transID string) (ConceptChanges, error) {
+					return ConceptChanges{UpdatedIds: []string{"uuid1"}}, ErrDeleteSource
 				},
 			},
 			statusCode: http.StatusBadRequest,
@@ -189,7 +211,7 @@ func TestDeleteHandler(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := mux.NewRouter()
-			handler := ConceptsHandler{test.ds}
+			handler := ConceptsHandler{ConceptsService: test.ds}
 			handler.RegisterHandlers(r)
 			rec := httptest.NewRecorder()
 			r.ServeHTTP(rec, test.req)
@@ -218,7 +240,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return ConceptChanges{}, nil
 				},
 			},
@@ -235,7 +257,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return ConceptChanges{}, nil
 				},
 			},
@@ -252,7 +274,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "FinancialInstrument"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return ConceptChanges{}, nil
 				},
 			},
@@ -269,7 +291,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "FinancialInstrument"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return ConceptChanges{}, nil
 				},
 			},
@@ -298,7 +320,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return ConceptChanges{}, nil
 				},
 			},
@@ -315,7 +337,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return nil, errors.New("TEST failing to WRITE")
 				},
 			},
@@ -323,6 +345,23 @@ func TestPutHandler(t *testing.T) {
 			contentType: "",
 			body:        errorMessage("TEST failing to WRITE"),
 		},
+		{
+			name: "WriteTimedOut",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return nil, context.DeadlineExceeded
+				},
+			},
+			statusCode:  http.StatusGatewayTimeout,
+			contentType: "",
+			body:        errorMessage(context.DeadlineExceeded.Error()),
+		},
 		{
 			name: "WriteFailedDueToConflict",
 			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s", knownUUID), t),
@@ -332,7 +371,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return nil, rwapi.ConstraintOrTransactionError{}
 				},
 			},
@@ -340,6 +379,46 @@ func TestPutHandler(t *testing.T) {
 			contentType: "",
 			body:        errorMessage(""),
 		},
+		{
+			name: "DryRunSuccess",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s?dryRun=true", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return nil, errors.New("TEST should not WRITE")
+				},
+				preview: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return WritePreview{
+						ConceptChanges: ConceptChanges{UpdatedIds: []string{knownUUID}},
+						Queries:        []PlannedQuery{{Cypher: "MATCH (t:Thing {uuid:$uuid}) RETURN t", Params: map[string]interface{}{"uuid": knownUUID}}},
+					}, nil
+				},
+			},
+			statusCode:  http.StatusOK,
+			contentType: "",
+			body:        "{\"events\":null,\"updatedIDs\":[\"12345\"],\"queries\":[{\"cypher\":\"MATCH (t:Thing {uuid:$uuid}) RETURN t\",\"params\":{\"uuid\":\"12345\"}}]}",
+		},
+		{
+			name: "DryRunFailed",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s?dryRun=true", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				preview: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return nil, requestError{"invalid request, no prefLabel has been supplied"}
+				},
+			},
+			statusCode:  http.StatusBadRequest,
+			contentType: "",
+			body:        errorMessage("invalid request, no prefLabel has been supplied"),
+		},
 		{
 			name: "BadConceptOrPath",
 			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s", knownUUID), t),
@@ -349,7 +428,7 @@ func TestPutHandler(t *testing.T) {
 						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "not-dummy"},
 					}, knownUUID, nil
 				},
-				write: func(thing interface{}, transID string) (interface{}, error) {
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
 					return ConceptChanges{}, nil
 				},
 			},
@@ -357,12 +436,83 @@ func TestPutHandler(t *testing.T) {
 			contentType: "",
 			body:        errorMessage("concept type does not match path"),
 		},
+		{
+			name: "ConcordanceConflict",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return ConceptChanges{}, &ConcordanceConflictError{Conflict: ConcordanceConflict{SourceUUID: "uuid-2"}}
+				},
+			},
+			statusCode:  http.StatusConflict,
+			contentType: "",
+			body:        errorMessage("Cannot currently process this record as it will break an existing concordance with prefUuid: uuid-2"),
+		},
+		{
+			name: "ForceTransfer",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s?force=transfer", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					if !opts.TransferConcordance {
+						return nil, errors.New("TEST should force the transfer")
+					}
+					return ConceptChanges{}, nil
+				},
+			},
+			statusCode:  http.StatusOK,
+			contentType: "",
+			body:        "{\"events\":null,\"updatedIDs\":null}",
+		},
+		{
+			name: "IncompleteTransfer",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s?force=transfer", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return ConceptChanges{}, &IncompleteTransferError{PrefUUID: "uuid-2", MissingSources: []string{"uuid-3", "uuid-4"}}
+				},
+			},
+			statusCode:  http.StatusConflict,
+			contentType: "",
+			body:        errorMessage("Cannot take over the concordance with prefUuid: uuid-2 without its sources: uuid-3, uuid-4"),
+		},
+		{
+			name: "UnknownForceOption",
+			req:  newRequest("PUT", fmt.Sprintf("/dummies/%s?force=everything", knownUUID), t),
+			mockService: &mockConceptService{
+				decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+					}, knownUUID, nil
+				},
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					return nil, errors.New("TEST should not WRITE")
+				},
+			},
+			statusCode:  http.StatusBadRequest,
+			contentType: "",
+			body:        errorMessage(`unknown force option "everything", only transfer is supported`),
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := mux.NewRouter()
-			handler := ConceptsHandler{test.mockService}
+			handler := ConceptsHandler{ConceptsService: test.mockService}
 			handler.RegisterHandlers(r)
 			rec := httptest.NewRecorder()
 			r.ServeHTTP(rec, test.req)
@@ -372,6 +522,52 @@ func TestPutHandler(t *testing.T) {
 	}
 }
 
+func TestPutHandlerCloudEvents(t *testing.T) {
+	mockService := &mockConceptService{
+		decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+			return ontology.CanonicalConcept{
+				CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+			}, knownUUID, nil
+		},
+		write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+			return ConceptChanges{
+				ChangedRecords: []Event{
+					{ConceptType: "Dummy", ConceptUUID: knownUUID, AggregateHash: "123", TransactionID: "tid_1", EventDetails: ConceptEvent{Type: UpdatedEvent}},
+					{ConceptType: "Dummy", ConceptUUID: "source-1", AggregateHash: "123", TransactionID: "tid_1", EventDetails: ConcordanceEvent{Type: AddedEvent, OldID: "source-1", NewID: knownUUID}},
+				},
+				UpdatedIds: []string{knownUUID, "source-1"},
+			}, nil
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService}
+	handler.RegisterHandlers(r)
+	req := newRequest("PUT", fmt.Sprintf("/dummies/%s", knownUUID), t)
+	req.Header.Set("Accept", "application/cloudevents-batch+json; charset=utf-8, application/json;q=0.5")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, CloudEventsBatchContentType, rec.Header().Get("Content-Type"))
+	var batch []map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &batch)) || !assert.Len(t, batch, 2) {
+		return
+	}
+	assert.Equal(t, "com.ft.concept.updated", batch[0]["type"])
+	assert.Regexp(t, "^[0-9a-f]{32}$", batch[0]["id"])
+	assert.NotEqual(t, batch[0]["id"], batch[1]["id"], "The events of a write should have distinct ids")
+	assert.Equal(t, knownUUID, batch[0]["subject"])
+	assert.Equal(t, "com.ft.concordance.added", batch[1]["type"])
+	assert.Equal(t, map[string]interface{}{
+		"conceptType":   "Dummy",
+		"conceptUUID":   "source-1",
+		"aggregateHash": "123",
+		"transactionID": "tid_1",
+		"oldID":         "source-1",
+		"newID":         knownUUID,
+	}, batch[1]["data"])
+}
+
 func TestGetHandler(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
@@ -445,6 +641,9 @@ func TestGetHandler(t *testing.T) {
 				read: func(uuid string, transID string) (interface{}, bool, error) {
 					return nil, false, nil
 				},
+				resolvePrefUUID: func(uuid, transID string) (string, bool, error) {
+					return "", false, nil
+				},
 			},
 			statusCode:  http.StatusNotFound,
 			contentType: "",
@@ -462,6 +661,18 @@ func TestGetHandler(t *testing.T) {
 			contentType: "",
 			body:        errorMessage("TEST failing to READ"),
 		},
+		{
+			name: "ReadTimedOut",
+			req:  newRequest("GET", fmt.Sprintf("/dummies/%s", knownUUID), t),
+			ds: &mockConceptService{
+				read: func(uuid string, transID string) (interface{}, bool, error) {
+					return nil, false, context.DeadlineExceeded
+				},
+			},
+			statusCode:  http.StatusGatewayTimeout,
+			contentType: "",
+			body:        errorMessage(context.DeadlineExceeded.Error()),
+		},
 		{
 			name: "BadConceptType",
 			req:  newRequest("GET", fmt.Sprintf("/dummies/%s", knownUUID), t),
@@ -481,7 +692,186 @@ func TestGetHandler(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := mux.NewRouter()
-			handler := ConceptsHandler{test.ds}
+			handler := ConceptsHandler{ConceptsService: test.ds}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, test.req)
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(test.body, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+func TestGetHandlerResolvesSourceUUID(t *testing.T) {
+	assert := assert.New(t)
+	mockService := &mockConceptService{
+		read: func(uuid string, transID string) (interface{}, bool, error) {
+			if uuid != knownUUID {
+				return nil, false, nil
+			}
+			return ontology.CanonicalConcept{
+				CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+			}, true, nil
+		},
+		resolvePrefUUID: func(uuid, transID string) (string, bool, error) {
+			switch uuid {
+			case "source":
+				return knownUUID, true, nil
+			case "ambiguous":
+				return "", false, ambiguousLookupError{prefUUIDs: []string{knownUUID, "99999"}}
+			}
+			return "", false, nil
+		},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		location   string
+		body       string
+	}{
+		{name: "SourceUUIDRedirect", path: "/dummies/source", statusCode: http.StatusTemporaryRedirect, location: "/dummies/12345"},
+		{name: "StrictSourceUUID", path: "/dummies/source?resolve=false", statusCode: http.StatusNotFound, body: errorMessage("Concept with prefUUID source not found in db.")},
+		{name: "AmbiguousSourceUUID", path: "/dummies/ambiguous", statusCode: http.StatusConflict, body: errorMessage(ErrAmbiguousLookup.Error(), knownUUID, "99999")},
+		{name: "SourceUUIDOfOtherType", path: "/brands/source", statusCode: http.StatusNotFound, body: errorMessage("Concept with prefUUID source not found in db.")},
+		{name: "UnknownUUID", path: "/dummies/unknown", statusCode: http.StatusNotFound, body: errorMessage("Concept with prefUUID unknown not found in db.")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(test.location, rec.Header().Get("Location"), fmt.Sprintf("%s: Wrong location", test.name))
+			assert.Equal(test.body, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	assert := assert.New(t)
+	mockService := &mockConceptService{
+		read: func(uuid string, transID string) (interface{}, bool, error) {
+			return ontology.CanonicalConcept{
+				CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy", AggregatedHash: "123"},
+			}, true, nil
+		},
+		decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+			return ontology.CanonicalConcept{
+				CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Dummy"},
+			}, knownUUID, nil
+		},
+		write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+			for _, hash := range opts.IfMatch {
+				if hash == "123" {
+					return ConceptChanges{}, nil
+				}
+			}
+			return nil, ErrPreconditionFailed
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService}
+	handler.RegisterHandlers(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("GET", fmt.Sprintf("/dummies/%s", knownUUID), t))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`"123"`, rec.Header().Get("ETag"))
+
+	tests := []struct {
+		name       string
+		ifMatch    string
+		statusCode int
+	}{
+		{name: "MatchingETag", ifMatch: `"123"`, statusCode: http.StatusOK},
+		{name: "MatchingETagInList", ifMatch: `"456", "123"`, statusCode: http.StatusOK},
+		{name: "StaleETag", ifMatch: `"456"`, statusCode: http.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := newRequest("PUT", fmt.Sprintf("/dummies/%s", knownUUID), t)
+			req.Header.Set("If-Match", test.ifMatch)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+		})
+	}
+}
+
+func TestLookupHandler(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name       string
+		req        *http.Request
+		ds         ConceptServicer
+		statusCode int
+		body       string
+	}{
+		{
+			name: "Success",
+			req:  newRequest("GET", "/lookup?authority=TME&authorityValue=1234", t),
+			ds: &mockConceptService{
+				lookupByAuthority: func(authority, authorityValue, transID string) (interface{}, bool, error) {
+					if authority != "TME" || authorityValue != "1234" {
+						return nil, false, nil
+					}
+					return ontology.CanonicalConcept{
+						CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Brand"},
+					}, true, nil
+				},
+			},
+			statusCode: http.StatusOK,
+			body:       "{\"prefUUID\":\"12345\",\"type\":\"Brand\"}\n",
+		},
+		{
+			name:       "MissingAuthorityValue",
+			req:        newRequest("GET", "/lookup?authority=TME", t),
+			ds:         &mockConceptService{},
+			statusCode: http.StatusBadRequest,
+			body:       errorMessage("authority and authorityValue query parameters are required"),
+		},
+		{
+			name: "NotFound",
+			req:  newRequest("GET", "/lookup?authority=TME&authorityValue=1234", t),
+			ds: &mockConceptService{
+				lookupByAuthority: func(authority, authorityValue, transID string) (interface{}, bool, error) {
+					return nil, false, nil
+				},
+			},
+			statusCode: http.StatusNotFound,
+			body:       errorMessage("Concept with authority TME and authorityValue 1234 not found in db."),
+		},
+		{
+			name: "Ambiguous",
+			req:  newRequest("GET", "/lookup?authority=TME&authorityValue=1234", t),
+			ds: &mockConceptService{
+				lookupByAuthority: func(authority, authorityValue, transID string) (interface{}, bool, error) {
+					return nil, false, ambiguousLookupError{prefUUIDs: []string{knownUUID, "99999"}}
+				},
+			},
+			statusCode: http.StatusConflict,
+			body:       errorMessage(ErrAmbiguousLookup.Error(), knownUUID, "99999"),
+		},
+		{
+			name: "LookupError",
+			req:  newRequest("GET", "/lookup?authority=TME&authorityValue=1234", t),
+			ds: &mockConceptService{
+				lookupByAuthority: func(authority, authorityValue, transID string) (interface{}, bool, error) {
+					return nil, false, errors.New("TEST failing to LOOKUP")
+				},
+			},
+			statusCode: http.StatusServiceUnavailable,
+			body:       errorMessage("TEST failing to LOOKUP"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: test.ds}
 			handler.RegisterHandlers(r)
 			rec := httptest.NewRecorder()
 			r.ServeHTTP(rec, test.req)
@@ -491,6 +881,1303 @@ func TestGetHandler(t *testing.T) {
 	}
 }
 
+func TestLookupByIdentifierHandler(t *testing.T) {
+	assert := assert.New(t)
+	mockService := &mockConceptService{
+		lookupByIdentifier: func(identifier, value, transID string) (interface{}, bool, error) {
+			switch {
+			case identifier == LEIIdentifier && value == "LEI1":
+				return ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Organisation"}}, true, nil
+			case identifier == FIGIIdentifier && value == "FIGI1":
+				return ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "FinancialInstrument"}}, true, nil
+			case identifier == ISO31661Identifier && value == "BG":
+				return ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: knownUUID, Type: "Location"}}, true, nil
+			case value == "failing":
+				return nil, false, errors.New("TEST failing to LOOKUP")
+			}
+			return nil, false, nil
+		},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		body       string
+	}{
+		{name: "LEI", path: "/organisations/by-lei/LEI1", statusCode: http.StatusOK, body: "{\"prefUUID\":\"12345\",\"type\":\"Organisation\"}\n"},
+		{name: "FIGI", path: "/financial-instruments/by-figi/FIGI1", statusCode: http.StatusOK, body: "{\"prefUUID\":\"12345\",\"type\":\"FinancialInstrument\"}\n"},
+		{name: "ISO31661", path: "/locations/by-iso31661/BG", statusCode: http.StatusOK, body: "{\"prefUUID\":\"12345\",\"type\":\"Location\"}\n"},
+		{name: "NotFound", path: "/locations/by-iso31661/ZZ", statusCode: http.StatusNotFound, body: errorMessage("Concept with ISO 3166-1 code ZZ not found in db.")},
+		{name: "LookupError", path: "/organisations/by-lei/failing", statusCode: http.StatusServiceUnavailable, body: errorMessage("TEST failing to LOOKUP")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(test.body, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+func TestListHandler(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name       string
+		path       string
+		list       func(opts ListOptions, transID string) (ConceptList, error)
+		statusCode int
+		body       string
+	}{
+		{
+			name: "Success",
+			path: "/locations?cursor=12345&limit=2&fields=prefLabel,aliases",
+			list: func(opts ListOptions, transID string) (ConceptList, error) {
+				if opts.Cursor != "12345" || opts.Limit != 2 || !assert.Equal([]string{"prefLabel", "aliases"}, opts.Fields) {
+					return ConceptList{}, errors.New("unexpected list options")
+				}
+				return ConceptList{
+					Concepts:   []map[string]interface{}{{"prefUUID": "23456", "type": "Location", "prefLabel": "Bulgaria"}},
+					NextCursor: "23456",
+				}, nil
+			},
+			statusCode: http.StatusOK,
+			body:       "{\"concepts\":[{\"prefLabel\":\"Bulgaria\",\"prefUUID\":\"23456\",\"type\":\"Location\"}],\"nextCursor\":\"23456\"}\n",
+		},
+		{
+			name: "DefaultLimit",
+			path: "/locations",
+			list: func(opts ListOptions, transID string) (ConceptList, error) {
+				if opts.Limit != DefaultListLimit || opts.Cursor != "" || opts.Fields != nil {
+					return ConceptList{}, errors.New("unexpected list options")
+				}
+				return ConceptList{Concepts: []map[string]interface{}{}}, nil
+			},
+			statusCode: http.StatusOK,
+			body:       "{\"concepts\":[]}\n",
+		},
+		{
+			name:       "InvalidLimit",
+			path:       "/locations?limit=5000",
+			statusCode: http.StatusBadRequest,
+			body:       errorMessage(fmt.Sprintf("limit must be a number between 1 and %d", MaxListLimit)),
+		},
+		{
+			name:       "UnknownType",
+			path:       "/not-a-types",
+			statusCode: http.StatusNotFound,
+			body:       errorMessage("unknown concept type not-a-types"),
+		},
+		{
+			name: "ListError",
+			path: "/locations",
+			list: func(opts ListOptions, transID string) (ConceptList, error) {
+				return ConceptList{}, errors.New("TEST failing to LIST")
+			},
+			statusCode: http.StatusServiceUnavailable,
+			body:       errorMessage("TEST failing to LIST"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: &mockConceptService{list: test.list}}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(test.body, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	assert := assert.New(t)
+	mockService := &mockConceptService{
+		stats: func(types []string, transID string) (map[string]TypeStats, error) {
+			stats := map[string]TypeStats{}
+			for _, conceptType := range types {
+				if conceptType == "Location" {
+					stats[conceptType] = TypeStats{Canonicals: 2, Sources: 3, Concordances: 1, LoneSources: 1, Deprecated: 1}
+				}
+			}
+			return stats, nil
+		},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "Stats",
+			path:       "/__stats",
+			statusCode: http.StatusOK,
+			body:       "{\"Location\":{\"canonicals\":2,\"sources\":3,\"concordances\":1,\"loneSources\":1,\"deprecated\":1}}\n",
+		},
+		{
+			name:       "Count",
+			path:       "/locations/__count",
+			statusCode: http.StatusOK,
+			body:       "{\"Location\":{\"canonicals\":2,\"sources\":3,\"concordances\":1,\"loneSources\":1,\"deprecated\":1}}\n",
+		},
+		{
+			name:       "UnknownType",
+			path:       "/not-a-types/__count",
+			statusCode: http.StatusNotFound,
+			body:       errorMessage("unknown concept type not-a-types"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(test.body, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+// mockOutbox serves its entries as ReadChanges does, the undecodable ones only moving the last id read
+type mockOutbox struct {
+	entries     []OutboxEntry
+	undecodable map[string]bool
+	// polls counts the empty pages read, which end every poll of the change feed
+	polls int
+}
+
+func (o *mockOutbox) add(entries ...OutboxEntry) {
+	o.entries = append(o.entries, entries...)
+	sort.Slice(o.entries, func(i, j int) bool { return o.entries[i].ID < o.entries[j].ID })
+}
+
+func (o *mockOutbox) read(after string, limit int) ([]OutboxEntry, string, error) {
+	var entries []OutboxEntry
+	last := after
+	for _, entry := range o.entries {
+		if entry.ID <= after || limit == 0 {
+			continue
+		}
+		limit--
+		last = entry.ID
+		if !o.undecodable[entry.ID] {
+			entries = append(entries, entry)
+		}
+	}
+	if last == after {
+		o.polls++
+	}
+	return entries, last, nil
+}
+
+func outboxEntry(writtenAt time.Time, conceptType string) OutboxEntry {
+	return OutboxEntry{
+		ID:    outboxCursorAt(writtenAt) + "-1a2b3c4d-0000",
+		Event: Event{ConceptType: conceptType, ConceptUUID: knownUUID, TransactionID: "tid_1", EventDetails: map[string]interface{}{"eventType": UpdatedEvent}},
+	}
+}
+
+func changeEvent(entry OutboxEntry) string {
+	return fmt.Sprintf("id: %s\nevent: CONCEPT_UPDATED\ndata: {\"type\":\"%s\",\"uuid\":\"12345\",\"aggregateHash\":\"\",\"transactionID\":\"tid_1\",\"eventDetails\":{\"eventType\":\"CONCEPT_UPDATED\"}}\n\n", entry.ID, entry.Event.ConceptType)
+}
+
+func TestStreamChangesHandler(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	resumed := outboxEntry(now.Add(-10*time.Second), "Brand")
+	sent := outboxEntry(now.Add(-2*time.Second), "Brand")
+	filtered := outboxEntry(now.Add(-3*time.Second), "Topic")
+	late := outboxEntry(now.Add(-5*time.Second), "Brand")
+	outbox := &mockOutbox{}
+	outbox.add(resumed, sent, filtered)
+	mockService := &mockConceptService{
+		readChanges: func(after string, limit int) ([]OutboxEntry, string, error) {
+			entries, last, err := outbox.read(after, limit)
+			switch outbox.polls {
+			case 1:
+				// a write that started before the entries already sent commits after them
+				outbox.add(late)
+			case 3:
+				cancel()
+			}
+			return entries, last, err
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService, ChangesPollInterval: time.Millisecond}
+	handler.RegisterHandlers(r)
+
+	req := newRequest("GET", "/__changes/stream?conceptType=Brand&eventType=CONCEPT_UPDATED", t).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", resumed.ID)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("text/event-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(changeEvent(resumed)+changeEvent(sent)+changeEvent(late), rec.Body.String(),
+		"The feed should send the events within the settle lag of the Last-Event-ID once, including the ones committed late")
+}
+
+func TestStreamChangesHandlerSettledEntriesAreNotReadAgain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	settled := outboxEntry(now.Add(-time.Minute), "Brand")
+	outbox := &mockOutbox{}
+	outbox.add(settled)
+	var cursors []string
+	mockService := &mockConceptService{
+		readChanges: func(after string, limit int) ([]OutboxEntry, string, error) {
+			cursors = append(cursors, after)
+			if outbox.polls == 2 {
+				cancel()
+			}
+			return outbox.read(after, limit)
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService, ChangesPollInterval: time.Millisecond, ChangesSettleLag: time.Second}
+	handler.RegisterHandlers(r)
+
+	req := newRequest("GET", "/__changes/stream", t).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", outboxCursorAt(now.Add(-2*time.Minute)))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, changeEvent(settled), rec.Body.String())
+	assert.Equal(t, settled.ID, cursors[len(cursors)-1], "The feed should move past the entries older than the settle lag")
+}
+
+func TestStreamChangesHandlerSkipsUndecodableEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	outbox := &mockOutbox{undecodable: map[string]bool{}}
+	// more entries that could not be decoded than a page holds
+	for i := 0; i < changesBatchSize+1; i++ {
+		entry := outboxEntry(now.Add(-time.Minute+time.Duration(i)*time.Millisecond), "Brand")
+		outbox.add(entry)
+		outbox.undecodable[entry.ID] = true
+	}
+	decodable := outboxEntry(now.Add(-time.Second), "Brand")
+	outbox.add(decodable)
+	mockService := &mockConceptService{
+		readChanges: func(after string, limit int) ([]OutboxEntry, string, error) {
+			if outbox.polls > 0 {
+				cancel()
+			}
+			return outbox.read(after, limit)
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService, ChangesPollInterval: time.Millisecond}
+	handler.RegisterHandlers(r)
+
+	req := newRequest("GET", "/__changes/stream", t).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", outboxCursorAt(now.Add(-2*time.Minute)))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, changeEvent(decodable), rec.Body.String(), "The feed should move past the entries that could not be decoded")
+}
+
+func TestStreamChangesHandlerFromNow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cursors []string
+	mockService := &mockConceptService{
+		readChanges: func(after string, limit int) ([]OutboxEntry, string, error) {
+			cursors = append(cursors, after)
+			cancel()
+			return nil, after, nil
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService, ChangesPollInterval: time.Millisecond}
+	handler.RegisterHandlers(r)
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("GET", "/__changes/stream", t).WithContext(ctx))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, cursors, 1) {
+		at, ok := outboxTime(cursors[0])
+		assert.True(t, ok)
+		assert.WithinDuration(t, start, at, time.Second, "Without a Last-Event-ID the feed should start with the events written from now on")
+	}
+}
+
+func TestStreamChangesHandlerOutboxDisabled(t *testing.T) {
+	mockService := &mockConceptService{
+		readChanges: func(after string, limit int) ([]OutboxEntry, string, error) {
+			return nil, after, ErrOutboxDisabled
+		},
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService}
+	handler.RegisterHandlers(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("GET", "/__changes/stream", t))
+
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Equal(t, errorMessage(ErrOutboxDisabled.Error()), rec.Body.String())
+}
+
+func TestSubscriptionsHandler(t *testing.T) {
+	assert := assert.New(t)
+	existing := Subscription{ID: "sub-1", URL: "https://example.com/hook", Secret: "s3cret", ConceptTypes: []string{"Brand"}}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		storeErr   error
+		statusCode int
+		response   string
+		stored     *Subscription
+	}{
+		{
+			name:       "List",
+			method:     "GET",
+			path:       "/__subscriptions",
+			statusCode: http.StatusOK,
+			response:   "[{\"id\":\"sub-1\",\"url\":\"https://example.com/hook\",\"conceptTypes\":[\"Brand\"]}]\n",
+		},
+		{
+			name:       "Get",
+			method:     "GET",
+			path:       "/__subscriptions/sub-1",
+			statusCode: http.StatusOK,
+			response:   "{\"id\":\"sub-1\",\"url\":\"https://example.com/hook\",\"conceptTypes\":[\"Brand\"]}\n",
+		},
+		{
+			name:       "GetNotFound",
+			method:     "GET",
+			path:       "/__subscriptions/sub-2",
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Subscription sub-2 not found."),
+		},
+		{
+			name:       "CreateInvalidURL",
+			method:     "POST",
+			path:       "/__subscriptions",
+			body:       `{"url":"/relative","secret":"s3cret"}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("url must be an absolute http or https URL"),
+		},
+		{
+			name:       "CreateHostNotAllowed",
+			method:     "POST",
+			path:       "/__subscriptions",
+			body:       `{"url":"http://169.254.169.254/latest/meta-data","secret":"s3cret"}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("webhooks cannot be registered for host 169.254.169.254"),
+		},
+		{
+			name:       "CreateWithoutSecret",
+			method:     "POST",
+			path:       "/__subscriptions",
+			body:       `{"url":"https://example.com/other"}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("secret is required to sign the requests"),
+		},
+		{
+			name:       "UpdateKeepsSecret",
+			method:     "PUT",
+			path:       "/__subscriptions/sub-1",
+			body:       `{"id":"ignored","url":"https://example.com/updated","eventTypes":["CONCEPT_UPDATED"]}`,
+			statusCode: http.StatusOK,
+			response:   "{\"id\":\"sub-1\",\"url\":\"https://example.com/updated\",\"eventTypes\":[\"CONCEPT_UPDATED\"]}\n",
+			stored:     &Subscription{ID: "sub-1", URL: "https://example.com/updated", Secret: "s3cret", EventTypes: []string{"CONCEPT_UPDATED"}},
+		},
+		{
+			name:       "Delete",
+			method:     "DELETE",
+			path:       "/__subscriptions/sub-1",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "DeleteNotFound",
+			method:     "DELETE",
+			path:       "/__subscriptions/sub-2",
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Subscription sub-2 not found."),
+		},
+		{
+			name:       "DeadLetters",
+			method:     "GET",
+			path:       "/__subscriptions/sub-1/dead-letters",
+			statusCode: http.StatusOK,
+			response:   "[]\n",
+		},
+		{
+			name:       "StoreError",
+			method:     "GET",
+			path:       "/__subscriptions",
+			storeErr:   errors.New("TEST failing to LIST"),
+			statusCode: http.StatusServiceUnavailable,
+			response:   errorMessage("TEST failing to LIST"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMockSubscriptionStore(existing)
+			store.err = test.storeErr
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: &mockConceptService{}, Subscriptions: store, WebhookHosts: []string{"example.com"}}
+			handler.RegisterHandlers(r)
+			req, err := http.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(test.response, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+			if test.stored != nil {
+				assert.Equal(*test.stored, store.subscriptions[test.stored.ID])
+			}
+		})
+	}
+}
+
+func TestSubscriptionsHandlerTimeout(t *testing.T) {
+	store := newMockSubscriptionStore(Subscription{ID: "sub-1", URL: "https://example.com/hook", Secret: "s3cret"})
+	store.block = true
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: &mockConceptService{}, Subscriptions: store, WebhookHosts: []string{"example.com"}, ReadTimeout: time.Millisecond, WriteTimeout: time.Millisecond}
+	handler.RegisterHandlers(r)
+	requests := map[string]string{
+		"GET /__subscriptions":                    "",
+		"POST /__subscriptions":                   `{"url":"https://example.com/hook","secret":"s3cret"}`,
+		"GET /__subscriptions/sub-1":              "",
+		"DELETE /__subscriptions/sub-1":           "",
+		"GET /__subscriptions/sub-1/dead-letters": "",
+	}
+	for request, body := range requests {
+		method, path, _ := strings.Cut(request, " ")
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code, request)
+		assert.Equal(t, errorMessage(context.DeadlineExceeded.Error()), rec.Body.String(), request)
+	}
+}
+
+func TestCreateSubscriptionHandler(t *testing.T) {
+	store := newMockSubscriptionStore()
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: &mockConceptService{}, Subscriptions: store, WebhookHosts: []string{"example.com"}}
+	handler.RegisterHandlers(r)
+	req, err := http.NewRequest("POST", "/__subscriptions", strings.NewReader(`{"url":"https://example.com/hook","secret":"s3cret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created Subscription
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.Empty(t, created.Secret, "The secret should never be returned")
+	assert.Equal(t, Subscription{ID: created.ID, URL: "https://example.com/hook", Secret: "s3cret"}, store.subscriptions[created.ID])
+}
+
+func TestSubscriptionsHandlerDisabled(t *testing.T) {
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: &mockConceptService{}}
+	handler.RegisterHandlers(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("GET", "/__subscriptions", t))
+
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Equal(t, errorMessage("webhook subscriptions are not enabled"), rec.Body.String())
+}
+
+func TestVersionHandlers(t *testing.T) {
+	writtenAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := ConceptVersion{
+		ID:            "version-1",
+		PrefUUID:      "uuid-1",
+		ConceptType:   "Brand",
+		AggregateHash: "111",
+		TransactionID: "tid_1",
+		WrittenAt:     writtenAt,
+		Concept:       &ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: "uuid-1", PrefLabel: "Old Label", Type: "Brand", AggregatedHash: "111"}},
+	}
+	second := ConceptVersion{
+		ID:            "version-2",
+		PrefUUID:      "uuid-1",
+		ConceptType:   "Brand",
+		AggregateHash: "222",
+		TransactionID: "tid_2",
+		Author:        "editor@example.com",
+		WrittenAt:     writtenAt.Add(time.Hour),
+		ChangeLog:     ChangeLog{{Op: ChangeLogReplace, Path: "/prefLabel", From: "Old Label", To: "New Label"}},
+		Concept:       &ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: "uuid-1", PrefLabel: "New Label", Type: "Brand", AggregatedHash: "222"}},
+	}
+	encode := func(v interface{}) string {
+		body, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body) + "\n"
+	}
+	summary := func(v ConceptVersion) ConceptVersion {
+		v.Concept = nil
+		return v
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		storeErr   error
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "History",
+			path:       "/brands/uuid-1/history",
+			statusCode: http.StatusOK,
+			response:   encode([]ConceptVersion{summary(second), summary(first)}),
+		},
+		{
+			name:       "HistoryNotFound",
+			path:       "/brands/uuid-2/history",
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("No history found for concept with prefUUID uuid-2.", "uuid-2"),
+		},
+		{
+			name:       "HistoryWrongType",
+			path:       "/people/uuid-1/history",
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("concept type does not match path", "uuid-1"),
+		},
+		{
+			name:       "Version",
+			path:       "/brands/uuid-1/versions/111",
+			statusCode: http.StatusOK,
+			response:   encode(first),
+		},
+		{
+			name:       "VersionNotFound",
+			path:       "/brands/uuid-1/versions/333",
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Version 333 of concept with prefUUID uuid-1 not found.", "uuid-1"),
+		},
+		{
+			name:       "StoreError",
+			path:       "/brands/uuid-1/history",
+			storeErr:   errors.New("TEST failing to READ"),
+			statusCode: http.StatusServiceUnavailable,
+			response:   errorMessage("TEST failing to READ", "uuid-1"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMockVersionStore(first, second)
+			store.err = test.storeErr
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: &mockConceptService{}, Versions: store}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+			assert.Equal(t, test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(t, test.response, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: &mockConceptService{}}
+	handler.RegisterHandlers(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("GET", "/brands/uuid-1/history", t))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Equal(t, errorMessage("the version history is not enabled"), rec.Body.String())
+}
+
+func TestRollbackHandler(t *testing.T) {
+	version := ConceptVersion{
+		ID:            "version-1",
+		PrefUUID:      "uuid-1",
+		ConceptType:   "Brand",
+		AggregateHash: "111",
+		Concept:       &ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: "uuid-1", PrefLabel: "Old Label", Type: "Brand", AggregatedHash: "111"}},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		ifMatch    string
+		writeErr   error
+		statusCode int
+		response   string
+		written    *ontology.CanonicalConcept
+	}{
+		{
+			name:       "Success",
+			path:       "/brands/uuid-1/rollback?toHash=111",
+			statusCode: http.StatusOK,
+			response:   `{"events":null,"updatedIDs":["uuid-1"]}`,
+			written:    &ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: "uuid-1", PrefLabel: "Old Label", Type: "Brand"}},
+		},
+		{
+			name:       "MissingHash",
+			path:       "/brands/uuid-1/rollback",
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("toHash is required", "uuid-1"),
+		},
+		{
+			name:       "VersionNotFound",
+			path:       "/brands/uuid-1/rollback?toHash=222",
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Version 222 of concept with prefUUID uuid-1 not found.", "uuid-1"),
+		},
+		{
+			name:       "WrongType",
+			path:       "/people/uuid-1/rollback?toHash=111",
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("concept type does not match path", "uuid-1"),
+		},
+		{
+			name:       "PreconditionFailed",
+			path:       "/brands/uuid-1/rollback?toHash=111",
+			ifMatch:    `"333"`,
+			writeErr:   ErrPreconditionFailed,
+			statusCode: http.StatusPreconditionFailed,
+			response:   errorMessage(ErrPreconditionFailed.Error()),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var written *ontology.CanonicalConcept
+			var writeOpts WriteOptions
+			mockService := &mockConceptService{
+				write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+					concept := thing.(ontology.CanonicalConcept)
+					written, writeOpts = &concept, opts
+					if test.writeErr != nil {
+						return nil, test.writeErr
+					}
+					return ConceptChanges{UpdatedIds: []string{concept.PrefUUID}}, nil
+				},
+			}
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService, Versions: newMockVersionStore(version)}
+			handler.RegisterHandlers(r)
+			req := newRequest("POST", test.path, t)
+			req.Header.Set(AuthorHeader, "editor@example.com")
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(t, test.response, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+			if test.written != nil {
+				assert.Equal(t, test.written, written, "The version should be written without its aggregate hash")
+				assert.Equal(t, "editor@example.com", writeOpts.Author)
+			}
+			if test.ifMatch != "" {
+				assert.Equal(t, []string{"333"}, writeOpts.IfMatch, "The rollback should be conditional as a PUT")
+			}
+		})
+	}
+}
+
+func TestUnconcordHandler(t *testing.T) {
+	brand := ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: "uuid-1", Type: "Brand"}}
+	removed := Event{ConceptType: "Brand", ConceptUUID: "uuid-2", TransactionID: "tid_1", EventDetails: ConcordanceEvent{Type: RemovedEvent, OldID: "uuid-1", NewID: "uuid-2"}}
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		unconcordErr error
+		statusCode   int
+		response     string
+	}{
+		{
+			name:       "Success",
+			path:       "/brands/uuid-1/unconcord",
+			body:       `{"uuids":["uuid-2"]}`,
+			statusCode: http.StatusOK,
+			response:   `{"events":[{"type":"Brand","uuid":"uuid-2","aggregateHash":"","transactionID":"tid_1","eventDetails":{"eventType":"CONCORDANCE_REMOVED","oldID":"uuid-1","newID":"uuid-2"}}],"updatedIDs":["uuid-2"]}` + "\n",
+		},
+		{
+			name:       "NoUUIDs",
+			path:       "/brands/uuid-1/unconcord",
+			body:       `{"uuids":[]}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("uuids of the sources to unconcord are required", "uuid-1"),
+		},
+		{
+			name:       "NotFound",
+			path:       "/brands/uuid-3/unconcord",
+			body:       `{"uuids":["uuid-2"]}`,
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Concept with prefUUID uuid-3 not found in db.", "uuid-3"),
+		},
+		{
+			name:       "WrongType",
+			path:       "/people/uuid-1/unconcord",
+			body:       `{"uuids":["uuid-2"]}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("concept type does not match path", "uuid-1"),
+		},
+		{
+			name:         "NotASource",
+			path:         "/brands/uuid-1/unconcord",
+			body:         `{"uuids":["uuid-4"]}`,
+			unconcordErr: requestError{"uuid-4 is not a source of concept uuid-1"},
+			statusCode:   http.StatusBadRequest,
+			response:     errorMessage("uuid-4 is not a source of concept uuid-1", "uuid-1"),
+		},
+		{
+			name:         "ConcurrentWrite",
+			path:         "/brands/uuid-1/unconcord",
+			body:         `{"uuids":["uuid-2"]}`,
+			unconcordErr: ErrPreconditionFailed,
+			statusCode:   http.StatusPreconditionFailed,
+			response:     errorMessage(ErrPreconditionFailed.Error(), "uuid-1"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockService := &mockConceptService{
+				read: func(uuid string, transID string) (interface{}, bool, error) {
+					return brand, uuid == brand.PrefUUID, nil
+				},
+				unconcord: func(prefUUID string, sourceUUIDs []string, transID string, opts WriteOptions) (ConceptChanges, error) {
+					if test.unconcordErr != nil {
+						return ConceptChanges{}, test.unconcordErr
+					}
+					assert.Equal(t, []string{"uuid-2"}, sourceUUIDs)
+					return ConceptChanges{ChangedRecords: []Event{removed}, UpdatedIds: sourceUUIDs}, nil
+				},
+			}
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService}
+			handler.RegisterHandlers(r)
+			req, err := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(t, test.response, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+func TestConcordanceHandler(t *testing.T) {
+	graph := ConcordanceGraph{
+		Canonical: ConcordanceCanonical{PrefUUID: "uuid-1", PrefLabel: "Label", Type: "Brand", AggregateHash: "111"},
+		Sources: []ConcordanceSource{
+			{UUID: "uuid-1", PrefLabel: "Label", Type: "Brand", Authority: "Smartlogic", AuthorityValue: "uuid-1"},
+			{UUID: "uuid-2", PrefLabel: "Label", Type: "Brand", Authority: "TME", AuthorityValue: "tme-2", Incoming: 3, IncomingTypes: map[string]int{"HAS_BRAND": 2, "IS_RELATED_TO": 1}},
+		},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		readErr    error
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "Canonical",
+			path:       "/brands/uuid-1/concordance",
+			statusCode: http.StatusOK,
+			response: `{"canonical":{"prefUUID":"uuid-1","prefLabel":"Label","type":"Brand","aggregateHash":"111"},"sources":[` +
+				`{"uuid":"uuid-1","prefLabel":"Label","type":"Brand","authority":"Smartlogic","authorityValue":"uuid-1","incoming":0},` +
+				`{"uuid":"uuid-2","prefLabel":"Label","type":"Brand","authority":"TME","authorityValue":"tme-2","incoming":3,"incomingTypes":{"HAS_BRAND":2,"IS_RELATED_TO":1}}]}` + "\n",
+		},
+		{
+			name:       "Source",
+			path:       "/brands/uuid-2/concordance",
+			statusCode: http.StatusOK,
+			response: `{"canonical":{"prefUUID":"uuid-1","prefLabel":"Label","type":"Brand","aggregateHash":"111"},"sources":[` +
+				`{"uuid":"uuid-1","prefLabel":"Label","type":"Brand","authority":"Smartlogic","authorityValue":"uuid-1","incoming":0},` +
+				`{"uuid":"uuid-2","prefLabel":"Label","type":"Brand","authority":"TME","authorityValue":"tme-2","incoming":3,"incomingTypes":{"HAS_BRAND":2,"IS_RELATED_TO":1}}]}` + "\n",
+		},
+		{
+			name:       "NotFound",
+			path:       "/brands/uuid-3/concordance",
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Concept with UUID uuid-3 not found in db.", "uuid-3"),
+		},
+		{
+			name:       "WrongType",
+			path:       "/people/uuid-1/concordance",
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("concept type does not match path", "uuid-1"),
+		},
+		{
+			name:       "ReadError",
+			path:       "/brands/uuid-1/concordance",
+			readErr:    errors.New("neo4j unavailable"),
+			statusCode: http.StatusServiceUnavailable,
+			response:   errorMessage("neo4j unavailable", "uuid-1"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockService := &mockConceptService{
+				readConcordance: func(uuid string, transID string) (ConcordanceGraph, bool, error) {
+					if test.readErr != nil {
+						return ConcordanceGraph{}, false, test.readErr
+					}
+					for _, source := range graph.Sources {
+						if source.UUID == uuid {
+							return graph, true, nil
+						}
+					}
+					return ConcordanceGraph{}, false, nil
+				},
+			}
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+
+			assert.Equal(t, test.statusCode, rec.Code)
+			assert.Equal(t, test.response, rec.Body.String())
+		})
+	}
+}
+
+func TestMergeHandler(t *testing.T) {
+	brand := ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{PrefUUID: "uuid-1", Type: "Brand"}}
+	added := Event{ConceptType: "Brand", ConceptUUID: "uuid-2", TransactionID: "tid_1", EventDetails: ConcordanceEvent{Type: AddedEvent, OldID: "uuid-2", NewID: "uuid-1"}}
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		mergeErr   error
+		statusCode int
+		response   string
+		opts       MergeOptions
+	}{
+		{
+			name:       "Success",
+			path:       "/brands/uuid-1/merge",
+			body:       `{"prefUUID":"uuid-2","supersededBy":true}`,
+			statusCode: http.StatusOK,
+			response:   `{"events":[{"type":"Brand","uuid":"uuid-2","aggregateHash":"","transactionID":"tid_1","eventDetails":{"eventType":"CONCORDANCE_ADDED","oldID":"uuid-2","newID":"uuid-1"}}],"updatedIDs":["uuid-1","uuid-2"]}` + "\n",
+			opts:       MergeOptions{WriteOptions: WriteOptions{Author: "editor@example.com"}, SupersededBy: true},
+		},
+		{
+			name:       "NoPrefUUID",
+			path:       "/brands/uuid-1/merge",
+			body:       `{}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("prefUUID of the concept to merge is required", "uuid-1"),
+		},
+		{
+			name:       "NotFound",
+			path:       "/brands/uuid-3/merge",
+			body:       `{"prefUUID":"uuid-2"}`,
+			statusCode: http.StatusNotFound,
+			response:   errorMessage("Concept with prefUUID uuid-3 not found in db.", "uuid-3"),
+		},
+		{
+			name:       "WrongType",
+			path:       "/people/uuid-1/merge",
+			body:       `{"prefUUID":"uuid-2"}`,
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("concept type does not match path", "uuid-1"),
+		},
+		{
+			name:       "MergedNotFound",
+			path:       "/brands/uuid-1/merge",
+			body:       `{"prefUUID":"uuid-4"}`,
+			mergeErr:   requestError{"concept uuid-4 to merge was not found"},
+			statusCode: http.StatusBadRequest,
+			response:   errorMessage("concept uuid-4 to merge was not found", "uuid-1", "uuid-4"),
+		},
+		{
+			name:       "ServiceError",
+			path:       "/brands/uuid-1/merge",
+			body:       `{"prefUUID":"uuid-2"}`,
+			mergeErr:   errors.New("TEST failing to MERGE"),
+			statusCode: http.StatusServiceUnavailable,
+			response:   errorMessage("TEST failing to MERGE", "uuid-1", "uuid-2"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockService := &mockConceptService{
+				read: func(uuid string, transID string) (interface{}, bool, error) {
+					return brand, uuid == brand.PrefUUID, nil
+				},
+				merge: func(prefUUID, mergedUUID string, transID string, opts MergeOptions) (ConceptChanges, error) {
+					if test.mergeErr != nil {
+						return ConceptChanges{}, test.mergeErr
+					}
+					assert.Equal(t, test.opts, opts)
+					return ConceptChanges{ChangedRecords: []Event{added}, UpdatedIds: []string{prefUUID, mergedUUID}}, nil
+				},
+			}
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: mockService}
+			handler.RegisterHandlers(r)
+			req, err := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(AuthorHeader, "editor@example.com")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, test.statusCode, rec.Code, fmt.Sprintf("%s: Wrong response code, was %d, should be %d", test.name, rec.Code, test.statusCode))
+			assert.Equal(t, test.response, rec.Body.String(), fmt.Sprintf("%s: Wrong body", test.name))
+		})
+	}
+}
+
+func TestConflictsHandler(t *testing.T) {
+	seen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	brand := ConcordanceConflict{
+		ID:          "uuid-1:uuid-2",
+		SourceUUID:  "uuid-2",
+		FirstSeen:   seen,
+		LastSeen:    seen,
+		Occurrences: 1,
+		Existing:    ConceptSummary{PrefUUID: "uuid-2", Type: "Brand", Authority: "TME", SourceUUIDs: []string{"uuid-2", "uuid-3"}},
+		Incoming:    ConceptSummary{PrefUUID: "uuid-1", Type: "Brand", Authority: "Smartlogic", SourceUUIDs: []string{"uuid-1", "uuid-2"}},
+	}
+	person := ConcordanceConflict{
+		ID:          "uuid-4:uuid-5",
+		SourceUUID:  "uuid-5",
+		FirstSeen:   seen,
+		LastSeen:    seen.Add(time.Hour),
+		Occurrences: 3,
+		Existing:    ConceptSummary{PrefUUID: "uuid-5", Type: "Person", Authority: "TME"},
+		Incoming:    ConceptSummary{PrefUUID: "uuid-4", Type: "Person", Authority: "Smartlogic"},
+	}
+	encode := func(v interface{}) string {
+		body, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body) + "\n"
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		store      ConflictStore
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "All",
+			path:       "/__conflicts",
+			store:      newMockConflictStore(brand, person),
+			statusCode: http.StatusOK,
+			response:   encode([]ConcordanceConflict{person, brand}),
+		},
+		{
+			name:       "ByType",
+			path:       "/__conflicts?type=Brand",
+			store:      newMockConflictStore(brand, person),
+			statusCode: http.StatusOK,
+			response:   encode([]ConcordanceConflict{brand}),
+		},
+		{
+			name:       "ByExistingConcept",
+			path:       "/__conflicts?prefUUID=uuid-2",
+			store:      newMockConflictStore(brand, person),
+			statusCode: http.StatusOK,
+			response:   encode([]ConcordanceConflict{brand}),
+		},
+		{
+			name:       "None",
+			path:       "/__conflicts",
+			store:      newMockConflictStore(),
+			statusCode: http.StatusOK,
+			response:   "[]\n",
+		},
+		{
+			name:       "StoreError",
+			path:       "/__conflicts",
+			store:      &mockConflictStore{err: errors.New("neo4j unavailable")},
+			statusCode: http.StatusServiceUnavailable,
+			response:   errorMessage("neo4j unavailable"),
+		},
+		{
+			name:       "Disabled",
+			path:       "/__conflicts",
+			statusCode: http.StatusNotImplemented,
+			response:   errorMessage("the concordance conflict report is not enabled"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: &mockConceptService{}, Conflicts: test.store}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", test.path, t))
+
+			assert.Equal(t, test.statusCode, rec.Code)
+			assert.Equal(t, test.response, rec.Body.String())
+		})
+	}
+}
+
+func TestConcordancePolicyHandler(t *testing.T) {
+	policy := ConcordancePolicy{
+		Default:      ConcordanceRule{Authorities: []string{"FactSet", "TME"}},
+		ConceptTypes: map[string]ConcordanceRule{"Location": {Transfers: []ConcordanceTransfer{{From: "ManagedLocation", To: AnyAuthority}}}},
+	}
+	tests := []struct {
+		name     string
+		policy   *ConcordancePolicy
+		response string
+	}{
+		{
+			name:     "Default",
+			response: `{"default":{"transfers":[{"from":"ManagedLocation","to":"*"},{"from":"Smartlogic","to":"*"}]}}` + "\n",
+		},
+		{
+			name:     "Configured",
+			policy:   &policy,
+			response: `{"default":{"authorities":["FactSet","TME"]},"conceptTypes":{"Location":{"transfers":[{"from":"ManagedLocation","to":"*"}]}}}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			handler := ConceptsHandler{ConceptsService: &mockConceptService{}, ConcordancePolicy: test.policy}
+			handler.RegisterHandlers(r)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", "/__config/concordance-policy", t))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, test.response, rec.Body.String())
+		})
+	}
+}
+
+func TestBulkWriteHandler(t *testing.T) {
+	assert := assert.New(t)
+	mockService := &mockConceptService{
+		decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+			concept := ontology.CanonicalConcept{}
+			err := decoder.Decode(&concept)
+			return concept, concept.PrefUUID, err
+		},
+		write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+			concept := thing.(ontology.CanonicalConcept)
+			switch concept.PrefUUID {
+			case "invalid":
+				return nil, requestError{"invalid request, no prefLabel has been supplied"}
+			case "failing":
+				return nil, errors.New("TEST failing to WRITE")
+			}
+			return ConceptChanges{UpdatedIds: []string{concept.PrefUUID}}, nil
+		},
+	}
+	body := strings.Join([]string{
+		`{"prefUUID":"12345","type":"Dummy"}`,
+		``,
+		`{"prefUUID":"invalid","type":"Dummy"}`,
+		`not json`,
+		`{"prefUUID":"failing","type":"Dummy"}`,
+	}, "\n")
+
+	req, err := http.NewRequest("POST", "/bulk/concepts", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: mockService, BulkConcurrency: 1}
+	handler.RegisterHandlers(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	var results []bulkWriteResult
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var result bulkWriteResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	if !assert.Len(results, 4) {
+		return
+	}
+	assert.Equal(bulkWriteResult{Line: 1, UUID: "12345", Status: http.StatusOK, Changes: map[string]interface{}{"events": nil, "updatedIDs": []interface{}{"12345"}}}, results[0])
+	assert.Equal(bulkWriteResult{Line: 3, UUID: "invalid", Status: http.StatusBadRequest, Error: "invalid request, no prefLabel has been supplied"}, results[1])
+	assert.Equal(4, results[2].Line)
+	assert.Equal(http.StatusBadRequest, results[2].Status)
+	assert.NotEmpty(results[2].Error)
+	assert.Equal(bulkWriteResult{Line: 5, UUID: "failing", Status: http.StatusServiceUnavailable, Error: "TEST failing to WRITE"}, results[3])
+}
+
+func TestBulkWriteHandlerOverHTTP(t *testing.T) {
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: newBulkMockService(), BulkConcurrency: 4}
+	handler.RegisterHandlers(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	assertBulkWritesAllLines(t, server.URL)
+}
+
+func TestBulkWriteHandlerWithRequestLogging(t *testing.T) {
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: newBulkMockService(), BulkConcurrency: 4}
+	handler.RegisterHandlers(r)
+	log := logger.NewUPPLogger("handlers_test", "PANIC")
+	server := httptest.NewServer(handler.RegisterAdminHandlers(r, log, "", "", "", true))
+	defer server.Close()
+
+	assertBulkWritesAllLines(t, server.URL)
+
+	// the request logging handler wraps the response writer, results should still be streamed while the body is read
+	bodyReader, bodyWriter := io.Pipe()
+	received := make(chan struct{})
+	go func() {
+		fmt.Fprintln(bodyWriter, `{"prefUUID":"uuid-1","type":"Dummy","prefLabel":"Label"}`)
+		select {
+		case <-received:
+			bodyWriter.Close()
+		case <-time.After(5 * time.Second):
+			// a spooled body would never see its end, so the request is given up instead
+			bodyWriter.CloseWithError(errors.New("no result before the end of the body"))
+		}
+	}()
+	resp, err := http.Post(server.URL+"/bulk/concepts", "application/x-ndjson", bodyReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result bulkWriteResult
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result), "The first result should be sent before the body is complete")
+	close(received)
+	assert.Equal(t, bulkWriteResult{Line: 1, UUID: "uuid-1", Status: http.StatusOK, Changes: map[string]interface{}{"events": nil, "updatedIDs": []interface{}{"uuid-1"}}}, result)
+}
+
+func TestBulkWriteHandlerBodyTooLarge(t *testing.T) {
+	line := `{"prefUUID":"uuid-1","type":"Dummy","prefLabel":"Label"}` + "\n"
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: newBulkMockService(), BulkConcurrency: 1, BulkMaxBodySize: int64(len(line) * 2)}
+	handler.RegisterHandlers(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	body := strings.Repeat(line, 3)
+
+	// the body is rejected up front when its length is known
+	resp, err := http.Post(server.URL+"/bulk/concepts", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// otherwise the lines within the limit are written and the last result reports the limit
+	resp, err = http.Post(server.URL+"/bulk/concepts", "application/x-ndjson", io.MultiReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	results := map[int]bulkWriteResult{}
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var result bulkWriteResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		results[result.Line] = result
+	}
+	assert.Len(t, results, 3)
+	assert.Equal(t, http.StatusOK, results[1].Status)
+	assert.Equal(t, http.StatusOK, results[2].Status)
+	assert.Equal(t, bulkWriteResult{Line: 3, Status: http.StatusRequestEntityTooLarge, Error: fmt.Sprintf("request body is larger than %d bytes", len(line)*2)}, results[3])
+}
+
+func TestBulkWriteHandlerSpooledBodyTooLarge(t *testing.T) {
+	// the recorder cannot stream, so the body is spooled up to the limit
+	line := `{"prefUUID":"uuid-1","type":"Dummy","prefLabel":"Label"}` + "\n"
+	req, err := http.NewRequest("POST", "/bulk/concepts", io.MultiReader(strings.NewReader(strings.Repeat(line, 3))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	handler := ConceptsHandler{ConceptsService: newBulkMockService(), BulkConcurrency: 1, BulkMaxBodySize: int64(len(line) * 2)}
+	handler.RegisterHandlers(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, errorMessage(fmt.Sprintf("request body is larger than %d bytes", len(line)*2)), rec.Body.String())
+}
+
+func newBulkMockService() *mockConceptService {
+	return &mockConceptService{
+		decodeJSON: func(decoder *json.Decoder) (interface{}, string, error) {
+			concept := ontology.CanonicalConcept{}
+			err := decoder.Decode(&concept)
+			return concept, concept.PrefUUID, err
+		},
+		write: func(thing interface{}, transID string, opts WriteOptions) (interface{}, error) {
+			return ConceptChanges{UpdatedIds: []string{thing.(ontology.CanonicalConcept).PrefUUID}}, nil
+		},
+	}
+}
+
+func assertBulkWritesAllLines(t *testing.T, serverURL string) {
+	t.Helper()
+	// long enough for results to be flushed while the body is still being read
+	const lines = 2000
+	var body strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&body, `{"prefUUID":"uuid-%d","type":"Dummy","prefLabel":"Label"}`+"\n", i)
+	}
+	resp, err := http.Post(serverURL+"/bulk/concepts", "application/x-ndjson", strings.NewReader(body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	written := map[int]bool{}
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var result bulkWriteResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, http.StatusOK, result.Status, "line %d: %s", result.Line, result.Error)
+		written[result.Line] = true
+	}
+	assert.Equal(t, lines, len(written), "Every line of the body should be written")
+}
+
 func TestGtgHandler(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
@@ -530,7 +2217,7 @@ func TestGtgHandler(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := mux.NewRouter()
-			handler := ConceptsHandler{test.ds}
+			handler := ConceptsHandler{ConceptsService: test.ds}
 			log := logger.NewUPPLogger("handlers_test", "PANIC")
 			sm := handler.RegisterAdminHandlers(r, log, "", "", "", true)
 			rec := httptest.NewRecorder()
@@ -557,8 +2244,11 @@ func errorMessage(errMsg string, uuids ...string) string {
 	return string(enc) + "\n"
 }
 
-func deleteSuccess(uuids ...string) string {
-	enc, err := json.Marshal(errorResponse{UUIDs: uuids})
+func deleteSuccess(events []Event, uuids ...string) string {
+	enc, err := json.Marshal(struct {
+		UUIDs  []string `json:"uuids"`
+		Events []Event  `json:"events"`
+	}{uuids, events})
 	if err != nil {
 		return ""
 	}
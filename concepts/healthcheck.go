@@ -1,6 +1,7 @@
 package concepts
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -39,7 +40,7 @@ func (h *ConceptsHandler) RegisterAdminHandlers(router *mux.Router, log *logger.
 	}
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
 
-	serveMux.Handle("/", monitoringRouter)
+	serveMux.Handle("/", withResponseController(monitoringRouter))
 
 	return serveMux
 }
@@ -71,7 +72,7 @@ func (h *ConceptsHandler) makeNeo4jAvailabilityCheck() fthealth.Check {
 }
 
 func (h *ConceptsHandler) checkNeo4jAvailability() (string, error) {
-	err := h.ConceptsService.Check()
+	err := h.ConceptsService.Check(context.Background())
 	if err != nil {
 		return "Could not connect to database!", err
 	}
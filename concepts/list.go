@@ -0,0 +1,110 @@
+package concepts
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/exp/slices"
+
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// defaultListFields are the canonical properties listed when no fields are requested
+var defaultListFields = []string{"prefLabel"}
+
+// ListOptions selects a page of canonical concepts
+type ListOptions struct {
+	// Types lists the concept types to include, matched against the most specific type of each canonical concept
+	Types []string
+	// Cursor is the prefUUID after which the page starts, empty for the first page
+	Cursor string
+	Limit  int
+	// Fields lists the canonical properties to include besides prefUUID and type
+	Fields []string
+}
+
+// ConceptList is a page of canonical concepts, ordered by prefUUID
+type ConceptList struct {
+	Concepts []map[string]interface{} `json:"concepts"`
+	// NextCursor is the cursor of the next page, empty when this is the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type listResult struct {
+	PrefUUID   string                 `json:"prefUUID"`
+	Types      []string               `json:"types"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// List returns a page of the canonical concepts of the given types.
+// Pages can be shorter than the limit, only an empty NextCursor means that there are no more concepts.
+func (s *ConceptService) List(ctx context.Context, opts ListOptions, transID string) (ConceptList, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		opts.Limit = MaxListLimit
+	}
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = defaultListFields
+	}
+
+	var result []listResult
+	query := &cmneo4j.Query{
+		Cypher: `
+			MATCH (canonical:Concept)
+			WHERE canonical.prefUUID > $cursor AND any(label IN labels(canonical) WHERE label IN $types)
+			RETURN canonical.prefUUID AS prefUUID, labels(canonical) AS types, properties(canonical) AS properties
+			ORDER BY prefUUID
+			LIMIT $limit`,
+		Params: map[string]interface{}{
+			"cursor": opts.Cursor,
+			"types":  opts.Types,
+			"limit":  opts.Limit,
+		},
+		Result: &result,
+	}
+	err := s.runRead(ctx, query)
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return ConceptList{Concepts: []map[string]interface{}{}}, nil
+	}
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).Error("Listing concepts resulted in error")
+		return ConceptList{}, err
+	}
+
+	list := ConceptList{Concepts: []map[string]interface{}{}}
+	for _, r := range result {
+		conceptType, err := ontology.MostSpecificType(r.Types)
+		if err != nil {
+			s.log.WithError(err).WithTransactionID(transID).WithUUID(r.PrefUUID).Warn("Could not work out the type of a listed concept")
+			continue
+		}
+		if !slices.Contains(opts.Types, conceptType) {
+			// a canonical concept of a more specific type which is not listed under this path
+			continue
+		}
+		concept := map[string]interface{}{
+			"prefUUID": r.PrefUUID,
+			"type":     conceptType,
+		}
+		for _, field := range fields {
+			if value, ok := r.Properties[field]; ok && field != "prefUUID" && field != "type" {
+				concept[field] = value
+			}
+		}
+		list.Concepts = append(list.Concepts, concept)
+	}
+	if len(result) == opts.Limit {
+		list.NextCursor = result[len(result)-1].PrefUUID
+	}
+	return list, nil
+}
@@ -0,0 +1,256 @@
+package concepts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultWriteLockTimeout = 10 * time.Second
+	// graphLockTTL is how long a lock node is honoured for, in case the writer holding it dies without releasing it
+	graphLockTTL = time.Minute
+	// graphLockRetryInterval is how often a lock node held by another writer is checked again
+	graphLockRetryInterval = 50 * time.Millisecond
+)
+
+// ErrLockTimeout is returned when a write could not get exclusive access to its concepts in time
+var ErrLockTimeout = errors.New("timed out waiting for concurrent writes of the same concepts to complete")
+
+// writeLocks serialises writes touching overlapping sets of concepts.
+// Writes are always serialised within the process, and optionally across replicas using lock nodes in Neo4j.
+type writeLocks struct {
+	local    *keyedLocker
+	graph    *graphLocker
+	timeout  time.Duration
+	wait     metrics.Timer
+	timeouts metrics.Counter
+}
+
+func newWriteLocks(timeout time.Duration) *writeLocks {
+	return &writeLocks{
+		local:    newKeyedLocker(),
+		timeout:  timeout,
+		wait:     metrics.GetOrRegisterTimer("concept-write-lock-wait", metrics.DefaultRegistry),
+		timeouts: metrics.GetOrRegisterCounter("concept-write-lock-timeouts", metrics.DefaultRegistry),
+	}
+}
+
+// acquire locks all the keys, in sorted order, and returns the function that releases them.
+// It gives up with ErrLockTimeout once the lock timeout expires, or with the context error once the context is done.
+func (l *writeLocks) acquire(ctx context.Context, keys []string) (func(), error) {
+	keys = uniqueSortedKeys(keys)
+	start := time.Now()
+	deadline := start.Add(l.timeout)
+
+	releaseLocal, err := l.local.lock(ctx, keys, deadline)
+	if err != nil {
+		if errors.Is(err, ErrLockTimeout) {
+			l.timeouts.Inc(1)
+		}
+		return nil, err
+	}
+	if l.graph == nil {
+		l.wait.UpdateSince(start)
+		return releaseLocal, nil
+	}
+
+	releaseGraph, err := l.graph.lock(ctx, keys, deadline)
+	if err != nil {
+		releaseLocal()
+		if errors.Is(err, ErrLockTimeout) {
+			l.timeouts.Inc(1)
+		}
+		return nil, err
+	}
+	l.wait.UpdateSince(start)
+
+	return func() {
+		releaseGraph()
+		releaseLocal()
+	}, nil
+}
+
+func uniqueSortedKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	var unique []string
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, key)
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// keyedLocker holds a mutex per key, created on demand and discarded once nobody is using it.
+type keyedLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	// sem is a semaphore of size one, so that waiting for the lock can time out
+	sem  chan struct{}
+	refs int
+}
+
+func newKeyedLocker() *keyedLocker {
+	return &keyedLocker{locks: map[string]*keyedLock{}}
+}
+
+// lock acquires the keys in the given order, waiting until the deadline at most.
+func (l *keyedLocker) lock(ctx context.Context, keys []string, deadline time.Time) (func(), error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	var acquired []string
+	for _, key := range keys {
+		lock := l.ref(key)
+		select {
+		case lock.sem <- struct{}{}:
+			acquired = append(acquired, key)
+		case <-timer.C:
+			l.unref(key)
+			l.unlock(acquired)
+			return nil, ErrLockTimeout
+		case <-ctx.Done():
+			l.unref(key)
+			l.unlock(acquired)
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() { l.unlock(acquired) }, nil
+}
+
+func (l *keyedLocker) unlock(keys []string) {
+	for _, key := range keys {
+		l.mu.Lock()
+		lock := l.locks[key]
+		l.mu.Unlock()
+		<-lock.sem
+		l.unref(key)
+	}
+}
+
+func (l *keyedLocker) ref(key string) *keyedLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyedLock{sem: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (l *keyedLocker) unref(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock := l.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// graphLocker uses ConceptWriteLock nodes in Neo4j as leases, so that replicas do not write the same concepts at once.
+type graphLocker struct {
+	driver *cmneo4j.Driver
+	ttl    time.Duration
+}
+
+// lock acquires the lock nodes one by one in the given order, retrying the ones held by other writers until the deadline.
+func (l *graphLocker) lock(ctx context.Context, keys []string, deadline time.Time) (func(), error) {
+	owner, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	release := func() {
+		_ = l.driver.Write(&cmneo4j.Query{
+			Cypher: `
+				MATCH (l:ConceptWriteLock {owner:$owner})
+				WHERE l.key IN $keys
+				DELETE l`,
+			Params: map[string]interface{}{
+				"owner": owner,
+				"keys":  keys,
+			},
+		})
+	}
+
+	for _, key := range keys {
+		for {
+			acquired, err := l.tryLock(key, owner)
+			if err != nil {
+				release()
+				return nil, err
+			}
+			if acquired {
+				break
+			}
+			if time.Now().Add(graphLockRetryInterval).After(deadline) {
+				release()
+				return nil, ErrLockTimeout
+			}
+			select {
+			case <-time.After(graphLockRetryInterval):
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return release, nil
+}
+
+func (l *graphLocker) tryLock(key, owner string) (bool, error) {
+	var result []struct {
+		Acquired bool `json:"acquired"`
+	}
+	err := l.driver.Write(&cmneo4j.Query{
+		// the lock is written before its owner is checked, so that its node lock is held and two writers cannot both
+		// take it. Whether it was taken is returned by the write, as a read could go to a member that has not applied it.
+		Cypher: `
+			MERGE (l:ConceptWriteLock {key:$key})
+			SET l.checkedAt = timestamp()
+			WITH l, l.owner IS NULL OR l.owner = $owner OR l.expiresAt < timestamp() AS free
+			SET l.owner = CASE WHEN free THEN $owner ELSE l.owner END,
+				l.expiresAt = CASE WHEN free THEN timestamp() + $ttl ELSE l.expiresAt END
+			RETURN l.owner = $owner AS acquired`,
+		Params: map[string]interface{}{
+			"key":   key,
+			"owner": owner,
+			"ttl":   l.ttl.Milliseconds(),
+		},
+		Result: &result,
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(result) > 0 && result[0].Acquired, nil
+}
+
+// newToken returns a random identifier
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package concepts
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLocksSerialiseOverlappingKeys(t *testing.T) {
+	locks := newWriteLocks(time.Second)
+
+	release, err := locks.acquire(context.Background(), []string{"b", "a"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := locks.acquire(context.Background(), []string{"c", "b"})
+		if assert.NoError(t, err) {
+			release()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("overlapping keys should not be locked while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("overlapping keys should be locked once released")
+	}
+	assert.Empty(t, locks.local.locks, "unused locks should be discarded")
+}
+
+func TestWriteLocksAllowDisjointKeys(t *testing.T) {
+	locks := newWriteLocks(time.Second)
+
+	release, err := locks.acquire(context.Background(), []string{"a", "b"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+
+	otherRelease, err := locks.acquire(context.Background(), []string{"c", "d"})
+	if assert.NoError(t, err) {
+		otherRelease()
+	}
+}
+
+func TestWriteLocksTimeout(t *testing.T) {
+	locks := newWriteLocks(20 * time.Millisecond)
+
+	release, err := locks.acquire(context.Background(), []string{"a", "b"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = locks.acquire(context.Background(), []string{"a"})
+	assert.ErrorIs(t, err, ErrLockTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = locks.acquire(ctx, []string{"b"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	release()
+	assert.Empty(t, locks.local.locks, "unused locks should be discarded")
+}
+
+func TestWriteLocksConcurrentWriters(t *testing.T) {
+	locks := newWriteLocks(5 * time.Second)
+
+	var wg sync.WaitGroup
+	var inside int
+	var mu sync.Mutex
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys := []string{"shared", "a"}
+			if i%2 == 0 {
+				keys = []string{"b", "shared"}
+			}
+			release, err := locks.acquire(context.Background(), keys)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			inside++
+			assert.Equal(t, 1, inside, "only one writer should hold the shared key")
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			inside--
+			mu.Unlock()
+			release()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcordanceLockKeysMatchWriteLockKeys(t *testing.T) {
+	concept := ontology.CanonicalConcept{CanonicalConceptFields: ontology.CanonicalConceptFields{
+		PrefUUID: "uuid-1",
+		SourceRepresentations: []ontology.SourceConcept{
+			{SourceConceptFields: ontology.SourceConceptFields{UUID: "uuid-1"}},
+			{SourceConceptFields: ontology.SourceConceptFields{UUID: "uuid-2"}},
+		},
+	}}
+	result := &relationsResult{UUID: "uuid-2", PrefUUID: "uuid-1", ConcordancesUUIDs: []string{"uuid-2", "uuid-1"}}
+
+	assert.Equal(t, uniqueSortedKeys(writeLockKeys(concept)), uniqueSortedKeys(concordanceLockKeys("uuid-2", result)),
+		"Deleting a concordance should lock the keys a write of its canonical concept locks")
+	assert.True(t, containsAll([]string{"uuid-1", "uuid-2"}, []string{"uuid-2"}))
+	assert.False(t, containsAll([]string{"uuid-1"}, []string{"uuid-1", "uuid-3"}))
+}
@@ -0,0 +1,161 @@
+package concepts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+)
+
+// ErrAmbiguousLookup is returned when an identifier resolves to more than one canonical concept
+var ErrAmbiguousLookup = errors.New("identifier resolves to more than one canonical concept")
+
+// ambiguousLookupError lists the canonical concepts an ambiguous identifier resolves to
+type ambiguousLookupError struct {
+	prefUUIDs []string
+}
+
+func (e ambiguousLookupError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrAmbiguousLookup.Error(), e.prefUUIDs)
+}
+
+func (e ambiguousLookupError) Is(target error) bool {
+	return target == ErrAmbiguousLookup
+}
+
+// Identifiers that concepts can be looked up by
+const (
+	LEIIdentifier      = "lei"
+	FIGIIdentifier     = "figi"
+	ISO31661Identifier = "iso31661"
+)
+
+// identifierProperties maps each identifier to the label and property of the concepts holding it.
+// The properties are covered by the indexes and constraints created in Initialise.
+var identifierProperties = map[string]struct {
+	label    string
+	property string
+}{
+	LEIIdentifier:      {label: "Concept", property: "leiCode"},
+	FIGIIdentifier:     {label: "FinancialInstrument", property: "figiCode"},
+	ISO31661Identifier: {label: "Location", property: "iso31661"},
+}
+
+type prefUUIDResult struct {
+	PrefUUID string `json:"prefUUID"`
+}
+
+// LookupByAuthority reads the canonical concept of the source concept with the given authority and authorityValue
+func (s *ConceptService) LookupByAuthority(ctx context.Context, authority, authorityValue, transID string) (interface{}, bool, error) {
+	var result []prefUUIDResult
+	query := &cmneo4j.Query{
+		Cypher: `
+			MATCH (source:Concept {authorityValue:$authorityValue})-[:EQUIVALENT_TO]->(canonical:Concept)
+			WHERE source.authority = $authority
+			RETURN DISTINCT canonical.prefUUID AS prefUUID`,
+		Params: map[string]interface{}{
+			"authority":      authority,
+			"authorityValue": authorityValue,
+		},
+		Result: &result,
+	}
+	concept, found, err := s.lookup(ctx, query, &result, transID)
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).
+			WithField("authority", authority).
+			WithField("authorityValue", authorityValue).
+			Error("Lookup by authority resulted in error")
+		return ontology.CanonicalConcept{}, found, err
+	}
+	return concept, found, nil
+}
+
+// LookupByIdentifier reads the canonical concept holding the given value of an identifier such as the LEI code.
+// The identifier can be held by the canonical concept or by any of its source concepts.
+func (s *ConceptService) LookupByIdentifier(ctx context.Context, identifier, value, transID string) (interface{}, bool, error) {
+	props, ok := identifierProperties[identifier]
+	if !ok {
+		return ontology.CanonicalConcept{}, false, fmt.Errorf("unknown identifier %q", identifier)
+	}
+
+	var result []prefUUIDResult
+	query := &cmneo4j.Query{
+		Cypher: fmt.Sprintf(`
+			MATCH (concept:%s {%s:$value})
+			OPTIONAL MATCH (concept)-[:EQUIVALENT_TO]->(canonical:Concept)
+			WITH coalesce(canonical.prefUUID, concept.prefUUID) AS prefUUID
+			WHERE prefUUID IS NOT NULL
+			RETURN DISTINCT prefUUID`, props.label, props.property),
+		Params: map[string]interface{}{
+			"value": value,
+		},
+		Result: &result,
+	}
+	concept, found, err := s.lookup(ctx, query, &result, transID)
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).
+			WithField(props.property, value).
+			Error("Lookup by identifier resulted in error")
+		return ontology.CanonicalConcept{}, found, err
+	}
+	return concept, found, nil
+}
+
+// ResolvePrefUUID returns the prefUUID of the canonical concept that the concept with the given uuid is concorded to
+func (s *ConceptService) ResolvePrefUUID(ctx context.Context, uuid, transID string) (string, bool, error) {
+	var result []prefUUIDResult
+	query := &cmneo4j.Query{
+		Cypher: `
+			MATCH (source:Concept {uuid:$uuid})-[:EQUIVALENT_TO]->(canonical:Concept)
+			RETURN DISTINCT canonical.prefUUID AS prefUUID`,
+		Params: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &result,
+	}
+	prefUUID, found, err := s.resolve(ctx, query, &result)
+	if err != nil {
+		s.log.WithError(err).WithTransactionID(transID).WithUUID(uuid).Error("Resolving the canonical concept resulted in error")
+		return "", found, err
+	}
+	return prefUUID, found, nil
+}
+
+// lookup runs a query resolving an identifier to canonical prefUUIDs and reads the canonical concept it resolves to.
+func (s *ConceptService) lookup(ctx context.Context, query *cmneo4j.Query, result *[]prefUUIDResult, transID string) (ontology.CanonicalConcept, bool, error) {
+	prefUUID, found, err := s.resolve(ctx, query, result)
+	if err != nil || !found {
+		return ontology.CanonicalConcept{}, found, err
+	}
+	return s.read(ctx, prefUUID, transID)
+}
+
+// resolve runs a query resolving an identifier to canonical prefUUIDs.
+// The identifier is ambiguous when it resolves to more than one canonical concept.
+func (s *ConceptService) resolve(ctx context.Context, query *cmneo4j.Query, result *[]prefUUIDResult) (string, bool, error) {
+	err := s.runRead(ctx, query)
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	var prefUUIDs []string
+	for _, r := range *result {
+		if r.PrefUUID != "" {
+			prefUUIDs = append(prefUUIDs, r.PrefUUID)
+		}
+	}
+	switch len(prefUUIDs) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return prefUUIDs[0], true, nil
+	default:
+		return "", false, ambiguousLookupError{prefUUIDs: prefUUIDs}
+	}
+}
@@ -5,6 +5,18 @@ type ConceptChanges struct {
 	UpdatedIds     []string `json:"updatedIDs"`
 }
 
+// WritePreview holds the outcome of a dry-run write: the events that would be produced and the queries that would be
+// executed against Neo4j.
+type WritePreview struct {
+	ConceptChanges
+	Queries []PlannedQuery `json:"queries"`
+}
+
+type PlannedQuery struct {
+	Cypher string                 `json:"cypher"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
 type Event struct {
 	ConceptType   string      `json:"type"`
 	ConceptUUID   string      `json:"uuid"`
@@ -24,7 +36,7 @@ type ConcordanceEvent struct {
 }
 
 type ConceptChangeLogEvent struct {
-	Type              string `json:"eventType"`
-	AnnotationsChange bool   `json:"annotationsChange"`
-	ChangeLog         string `json:"changelog"`
+	Type              string    `json:"eventType"`
+	AnnotationsChange bool      `json:"annotationsChange"`
+	ChangeLog         ChangeLog `json:"changelog"`
 }
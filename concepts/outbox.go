@@ -0,0 +1,467 @@
+package concepts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxBatchSize    = 100
+	defaultOutboxLease        = 30 * time.Second
+	defaultOutboxRetention    = 7 * 24 * time.Hour
+	outboxCleanupInterval     = 10 * time.Minute
+	// outboxCleanupBatchSize limits how many delivered entries are removed in a single transaction
+	outboxCleanupBatchSize = 10000
+	// outboxRelayLeaseID identifies the single ConceptEventRelayLease node the relays take turns holding
+	outboxRelayLeaseID = "relay"
+)
+
+// ErrOutboxDisabled is returned when reading changes from a service which does not store its events in the outbox
+var ErrOutboxDisabled = errors.New("the event outbox is not enabled")
+
+// OutboxEntry is a concept change event stored in the outbox, waiting to be delivered
+type OutboxEntry struct {
+	// ID orders the entries by the time their transaction started, according to the clock of the writing replica
+	ID    string `json:"id"`
+	Event Event  `json:"event"`
+	// WrittenAt is when the transaction writing the entry started
+	WrittenAt time.Time `json:"writtenAt"`
+}
+
+// EventSink delivers concept change events outside of the writer.
+// Publish must only succeed once all the entries have been delivered, in the given order.
+type EventSink interface {
+	Publish(ctx context.Context, entries []OutboxEntry) error
+}
+
+// LogEventSink delivers the events to the application logs
+type LogEventSink struct {
+	Log *logger.UPPLogger
+	// Format is the representation of the logged events, the event details being logged when it is empty
+	Format EventFormat
+}
+
+func (s LogEventSink) Publish(_ context.Context, entries []OutboxEntry) error {
+	for _, entry := range entries {
+		var event interface{} = entry.Event.EventDetails
+		if s.Format == CloudEventsFormat {
+			body, err := s.Format.Encode(entry)
+			if err != nil {
+				return err
+			}
+			event = string(body)
+		}
+		s.Log.WithTransactionID(entry.Event.TransactionID).
+			WithUUID(entry.Event.ConceptUUID).
+			WithField("outboxID", entry.ID).
+			WithField("event", event).
+			Info("Concept change event")
+	}
+	return nil
+}
+
+// WithEventOutbox stores the events of every write and delete as ConceptEventOutbox nodes, in the same transaction
+// as the change itself
+func WithEventOutbox() ServiceOption {
+	return func(s *ConceptService) {
+		s.outbox = true
+	}
+}
+
+// outboxQuery returns the query storing the events in the outbox. The ids are taken from the clock of the writing
+// replica, so that writes do not wait for each other to number their events.
+func outboxQuery(events []Event) (*cmneo4j.Query, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+
+	entries := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = map[string]interface{}{
+			// the time comes first so that entries sort in the order they were written, the token keeps the ids of
+			// concurrent writes apart and the index keeps the order of the events of a single write
+			"id":            fmt.Sprintf("%020d-%s-%04d", now, token[:8], i),
+			"conceptUUID":   event.ConceptUUID,
+			"transactionID": event.TransactionID,
+			"event":         string(body),
+		}
+	}
+
+	return &cmneo4j.Query{
+		Cypher: `
+			UNWIND $entries AS entry
+			CREATE (o:ConceptEventOutbox)
+			SET o = entry, o.createdAt = timestamp(), o.pending = true`,
+		Params: map[string]interface{}{
+			"entries": entries,
+		},
+	}, nil
+}
+
+// outboxCursorAt returns the outbox id sorting before all the entries written from the given time onwards
+func outboxCursorAt(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+// outboxTime returns the time an outbox entry was written, which its id starts with
+func outboxTime(id string) (time.Time, bool) {
+	nanos, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+type outboxResult struct {
+	ID        string `json:"id"`
+	Event     string `json:"event"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// decodeOutboxEntries returns the entries whose event could be decoded, and the decoding errors of the others by id
+func decodeOutboxEntries(result []outboxResult, log *logger.UPPLogger) ([]OutboxEntry, map[string]error) {
+	entries := make([]OutboxEntry, 0, len(result))
+	var undecodable map[string]error
+	for _, res := range result {
+		var event Event
+		if err := json.Unmarshal([]byte(res.Event), &event); err != nil {
+			log.WithError(err).WithField("outboxID", res.ID).Error("Could not decode outbox entry")
+			if undecodable == nil {
+				undecodable = make(map[string]error)
+			}
+			undecodable[res.ID] = err
+			continue
+		}
+		entries = append(entries, OutboxEntry{ID: res.ID, Event: event, WrittenAt: time.UnixMilli(res.CreatedAt).UTC()})
+	}
+	return entries, undecodable
+}
+
+// ReadChanges returns the outbox entries written after the one with the given id, in the order of their ids, and the
+// id of the last entry read, from which reading carries on. Entries whose event cannot be decoded are skipped, the last
+// id moving past them so that readers do not stall on them.
+// An entry can commit after entries with a later id, which readers that already moved past its id only get by reading
+// again from before it.
+func (s *ConceptService) ReadChanges(ctx context.Context, after string, limit int) ([]OutboxEntry, string, error) {
+	if !s.outbox {
+		return nil, after, ErrOutboxDisabled
+	}
+
+	var result []outboxResult
+	err := s.runRead(ctx, &cmneo4j.Query{
+		Cypher: `
+			MATCH (o:ConceptEventOutbox)
+			WHERE o.id > $after
+			RETURN o.id AS id, o.event AS event, o.createdAt AS createdAt
+			ORDER BY id
+			LIMIT $limit`,
+		Params: map[string]interface{}{
+			"after": after,
+			"limit": limit,
+		},
+		Result: &result,
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) || (err == nil && len(result) == 0) {
+		return nil, after, nil
+	}
+	if err != nil {
+		return nil, after, err
+	}
+	entries, undecodable := decodeOutboxEntries(result, s.log)
+	for id := range undecodable {
+		s.log.WithField("outboxID", id).Warn("Skipping undecodable outbox entry in the changes feed")
+	}
+	return entries, result[len(result)-1].ID, nil
+}
+
+// OutboxRelayConfig configures an OutboxRelay, zero values meaning the defaults
+type OutboxRelayConfig struct {
+	// PollInterval is how often pending entries are looked for
+	PollInterval time.Duration
+	// BatchSize is the maximum number of entries published at once
+	BatchSize int
+	// Lease is how long a relay remains the only one publishing after claiming entries, which should be longer than
+	// publishing a batch takes
+	Lease time.Duration
+	// Retention is how long delivered entries are kept for
+	Retention time.Duration
+}
+
+// OutboxRelay delivers the pending outbox entries to a sink and marks them delivered.
+// Several relays can run against the same database, but only the one holding the relay lease publishes, so that the
+// entries are published one batch at a time in the order of their ids.
+// Entries are delivered at least once: they are published again if a relay fails before marking them delivered.
+type OutboxRelay struct {
+	driver    *cmneo4j.Driver
+	sink      EventSink
+	log       *logger.UPPLogger
+	config    OutboxRelayConfig
+	delivered metrics.Counter
+	failures  metrics.Counter
+	// owner identifies the relay in the relay lease
+	owner string
+}
+
+func NewOutboxRelay(driver *cmneo4j.Driver, sink EventSink, log *logger.UPPLogger, config OutboxRelayConfig) (*OutboxRelay, error) {
+	owner, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultOutboxPollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultOutboxBatchSize
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaultOutboxLease
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaultOutboxRetention
+	}
+	return &OutboxRelay{
+		driver:    driver,
+		sink:      sink,
+		log:       log,
+		config:    config,
+		delivered: metrics.GetOrRegisterCounter("concept-events-delivered", metrics.DefaultRegistry),
+		failures:  metrics.GetOrRegisterCounter("concept-events-delivery-failures", metrics.DefaultRegistry),
+		owner:     owner,
+	}, nil
+}
+
+// Run delivers pending entries until the context is done, then hands the relay lease over to the other relays.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	defer r.release()
+
+	lastCleanup := time.Now()
+	for {
+		for {
+			n, err := r.Deliver(ctx)
+			if err != nil {
+				r.log.WithError(err).Error("Could not deliver concept change events")
+			}
+			// keep going while there is a backlog
+			if err != nil || n < r.config.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) > outboxCleanupInterval {
+			if err := r.Cleanup(ctx); err != nil {
+				r.log.WithError(err).Error("Could not remove delivered concept change events")
+			}
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver claims a batch of pending entries, publishes them to the sink and marks them delivered.
+// It returns the number of entries delivered, which is zero while another relay holds the relay lease.
+func (r *OutboxRelay) Deliver(ctx context.Context) (int, error) {
+	entries, err := r.claim(ctx)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	if err := r.sink.Publish(ctx, entries); err != nil {
+		r.failures.Inc(int64(len(entries)))
+		// the entries stay pending, to be published first by whichever relay takes the lease next
+		r.release()
+		return 0, err
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	err = r.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			MATCH (o:ConceptEventOutbox)
+			WHERE o.id IN $ids
+			SET o.deliveredAt = timestamp()
+			REMOVE o.pending`,
+		Params: map[string]interface{}{
+			"ids": ids,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.delivered.Inc(int64(len(entries)))
+	return len(entries), nil
+}
+
+// claim takes or renews the relay lease and returns the oldest pending entries in the same transaction, so that they
+// are read from the instance taking the lease. Nothing is returned while another relay holds the lease.
+// Entries whose event cannot be decoded are never returned, they are marked failed instead.
+func (r *OutboxRelay) claim(ctx context.Context) ([]OutboxEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	held, err := r.leaseHeldByOther()
+	if err != nil || held {
+		return nil, err
+	}
+
+	var result []outboxResult
+	err = r.driver.Write(&cmneo4j.Query{
+		// the lease is written before it is checked, so that its lock is held and two relays cannot both take it
+		Cypher: `
+			MERGE (l:ConceptEventRelayLease {id:$leaseID})
+			SET l.checkedAt = timestamp()
+			WITH l
+			WHERE l.owner IS NULL OR l.owner = $owner OR l.expiresAt < timestamp()
+			SET l.owner = $owner, l.expiresAt = timestamp() + $lease
+			WITH l
+			MATCH (o:ConceptEventOutbox {pending:true})
+			WITH o ORDER BY o.id LIMIT $limit
+			RETURN o.id AS id, o.event AS event, o.createdAt AS createdAt
+			ORDER BY id`,
+		Params: map[string]interface{}{
+			"leaseID": outboxRelayLeaseID,
+			"owner":   r.owner,
+			"lease":   r.config.Lease.Milliseconds(),
+			"limit":   r.config.BatchSize,
+		},
+		Result: &result,
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, undecodable := decodeOutboxEntries(result, r.log)
+	if len(undecodable) > 0 {
+		r.markFailed(undecodable)
+	}
+	return entries, nil
+}
+
+// leaseHeldByOther tells whether another relay holds an unexpired relay lease, so that the relays waiting for it only
+// read the lease on every poll instead of writing it
+func (r *OutboxRelay) leaseHeldByOther() (bool, error) {
+	var result []struct {
+		Held bool `json:"held"`
+	}
+	err := r.driver.Read(&cmneo4j.Query{
+		Cypher: `
+			MATCH (l:ConceptEventRelayLease {id:$leaseID})
+			RETURN l.owner IS NOT NULL AND l.owner <> $owner AND l.expiresAt >= timestamp() AS held`,
+		Params: map[string]interface{}{
+			"leaseID": outboxRelayLeaseID,
+			"owner":   r.owner,
+		},
+		Result: &result,
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(result) > 0 && result[0].Held, nil
+}
+
+// markFailed marks the entries which cannot be delivered as delivered along with the reason they were not, so that
+// they are no longer claimed and are removed after the retention period like the delivered ones.
+func (r *OutboxRelay) markFailed(failures map[string]error) {
+	params := make([]map[string]interface{}, 0, len(failures))
+	for id, err := range failures {
+		params = append(params, map[string]interface{}{
+			"id":    id,
+			"error": err.Error(),
+		})
+	}
+	err := r.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			UNWIND $failures AS failure
+			MATCH (o:ConceptEventOutbox {id:failure.id})
+			SET o.deliveredAt = timestamp(), o.deliveryError = failure.error
+			REMOVE o.pending`,
+		Params: map[string]interface{}{
+			"failures": params,
+		},
+	})
+	if err != nil {
+		r.log.WithError(err).Warn("Could not mark undecodable outbox entries failed, they will be claimed again")
+		return
+	}
+	r.failures.Inc(int64(len(failures)))
+}
+
+// release gives up the relay lease if the relay holds it, letting another relay take it without waiting for it to expire
+func (r *OutboxRelay) release() {
+	err := r.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			MATCH (l:ConceptEventRelayLease {id:$leaseID, owner:$owner})
+			REMOVE l.owner, l.expiresAt`,
+		Params: map[string]interface{}{
+			"leaseID": outboxRelayLeaseID,
+			"owner":   r.owner,
+		},
+	})
+	if err != nil {
+		r.log.WithError(err).Warn("Could not release the outbox relay lease, other relays will wait for it to expire")
+	}
+}
+
+// Cleanup removes the entries delivered longer ago than the retention period, one batch per transaction.
+func (r *OutboxRelay) Cleanup(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var result []struct {
+			Removed int `json:"removed"`
+		}
+		err := r.driver.Write(&cmneo4j.Query{
+			Cypher: `
+				MATCH (o:ConceptEventOutbox)
+				WHERE o.deliveredAt < timestamp() - $retention
+				WITH o LIMIT $limit
+				DELETE o
+				RETURN count(o) AS removed`,
+			Params: map[string]interface{}{
+				"retention": r.config.Retention.Milliseconds(),
+				"limit":     outboxCleanupBatchSize,
+			},
+			Result: &result,
+		})
+		if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(result) == 0 || result[0].Removed < outboxCleanupBatchSize {
+			return nil
+		}
+	}
+}
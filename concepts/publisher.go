@@ -0,0 +1,200 @@
+package concepts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Message is a record sent to a topic of a message broker
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Producer sends messages to a message broker.
+// Send must only succeed once all the messages have been accepted by the broker, in the given order.
+type Producer interface {
+	Send(ctx context.Context, messages []Message) error
+}
+
+// EventPublisher is an EventSink publishing every event to a topic, keyed by the uuid of the concept it is about so that
+// the events of a concept go to the same partition. They stay in order there as long as they are published in order,
+// which the OutboxRelay does by publishing a single batch at a time across all replicas, a failed batch being published
+// again before any later one. The transaction ID of the write is sent in the X-Request-Id header.
+type EventPublisher struct {
+	producer Producer
+	topic    string
+	format   EventFormat
+}
+
+func NewEventPublisher(producer Producer, topic string, format EventFormat) *EventPublisher {
+	return &EventPublisher{producer: producer, topic: topic, format: format}
+}
+
+func (p *EventPublisher) Publish(ctx context.Context, entries []OutboxEntry) error {
+	messages := make([]Message, len(entries))
+	for i, entry := range entries {
+		value, err := p.format.Encode(entry)
+		if err != nil {
+			return err
+		}
+		messages[i] = Message{
+			Topic: p.topic,
+			Key:   entry.Event.ConceptUUID,
+			Value: value,
+			Headers: map[string]string{
+				"X-Request-Id": entry.Event.TransactionID,
+				// consumers can drop the duplicates of an event delivered more than once using its outbox id
+				"Message-Id": entry.ID,
+			},
+		}
+		if p.format == CloudEventsFormat {
+			// the content type tells CloudEvents consumers that the message is in structured mode
+			messages[i].Headers["content-type"] = CloudEventContentType
+		}
+	}
+	return p.producer.Send(ctx, messages)
+}
+
+// RESTProxyProducer sends messages through the v3 produce API of a Kafka REST proxy
+type RESTProxyProducer struct {
+	client    *http.Client
+	baseURL   string
+	clusterID string
+}
+
+func NewRESTProxyProducer(client *http.Client, baseURL, clusterID string) *RESTProxyProducer {
+	return &RESTProxyProducer{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), clusterID: clusterID}
+}
+
+type restProxyData struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type restProxyHeader struct {
+	Name string `json:"name"`
+	// Value is base64 encoded, which encoding/json does for byte slices
+	Value []byte `json:"value"`
+}
+
+type restProxyRecord struct {
+	Key     restProxyData     `json:"key"`
+	Value   restProxyData     `json:"value"`
+	Headers []restProxyHeader `json:"headers,omitempty"`
+}
+
+type restProxyResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Send produces every run of consecutive messages to the same topic in a single request, using the streaming mode of
+// the produce API, in which the records follow each other in the request and their results in the response. The proxy
+// produces the records of a request independently, so a failed Send may have produced some of the messages, which are
+// produced again when the batch is sent again: consumers get them at least once.
+func (p *RESTProxyProducer) Send(ctx context.Context, messages []Message) error {
+	for start := 0; start < len(messages); {
+		end := start + 1
+		for end < len(messages) && messages[end].Topic == messages[start].Topic {
+			end++
+		}
+		if err := p.send(ctx, messages[start].Topic, messages[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+func (p *RESTProxyProducer) send(ctx context.Context, topic string, messages []Message) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, msg := range messages {
+		if err := enc.Encode(newRESTProxyRecord(msg)); err != nil {
+			return err
+		}
+	}
+
+	endpoint := fmt.Sprintf("%s/v3/clusters/%s/topics/%s/records", p.baseURL, url.PathEscape(p.clusterID), url.PathEscape(topic))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var result restProxyResponse
+		_ = dec.Decode(&result)
+		return fmt.Errorf("producing to topic %s failed with status %d: %s", topic, resp.StatusCode, result.Message)
+	}
+	for i := range messages {
+		var result restProxyResponse
+		if err := dec.Decode(&result); err != nil {
+			return fmt.Errorf("producing to topic %s: reading the result of message %d of %d: %w", topic, i+1, len(messages), err)
+		}
+		if result.ErrorCode != 0 && (result.ErrorCode < 200 || result.ErrorCode > 299) {
+			return fmt.Errorf("producing to topic %s failed for message %d of %d with error code %d: %s", topic, i+1, len(messages), result.ErrorCode, result.Message)
+		}
+	}
+	return nil
+}
+
+func newRESTProxyRecord(msg Message) restProxyRecord {
+	record := restProxyRecord{
+		Key:   restProxyData{Type: "STRING", Data: msg.Key},
+		Value: restProxyData{Type: "JSON", Data: json.RawMessage(msg.Value)},
+	}
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		record.Headers = append(record.Headers, restProxyHeader{Name: name, Value: []byte(msg.Headers[name])})
+	}
+	return record
+}
+
+// MemoryBroker is a Producer keeping the messages in memory, standing in for a message broker in tests and local runs
+type MemoryBroker struct {
+	mu       sync.Mutex
+	messages map[string][]Message
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{messages: map[string][]Message{}}
+}
+
+func (b *MemoryBroker) Send(_ context.Context, messages []Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range messages {
+		b.messages[msg.Topic] = append(b.messages[msg.Topic], msg)
+	}
+	return nil
+}
+
+// Messages returns the messages sent to the topic, in the order they were sent
+func (b *MemoryBroker) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.messages[topic]...)
+}
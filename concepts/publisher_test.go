@@ -0,0 +1,113 @@
+package concepts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventPublisher(t *testing.T) {
+	broker := NewMemoryBroker()
+	publisher := NewEventPublisher(broker, "ConceptChanges", NativeEventFormat)
+
+	entries := []OutboxEntry{
+		{ID: "1", Event: Event{ConceptType: "Brand", ConceptUUID: "uuid-1", TransactionID: "tid_1", EventDetails: ConceptEvent{Type: UpdatedEvent}}},
+		{ID: "2", Event: Event{ConceptType: "Brand", ConceptUUID: "uuid-2", TransactionID: "tid_1", EventDetails: ConcordanceEvent{Type: AddedEvent, OldID: "uuid-2", NewID: "uuid-1"}}},
+	}
+	err := publisher.Publish(context.Background(), entries)
+	assert.NoError(t, err)
+
+	messages := broker.Messages("ConceptChanges")
+	if !assert.Len(t, messages, 2) {
+		return
+	}
+	for i, msg := range messages {
+		assert.Equal(t, entries[i].Event.ConceptUUID, msg.Key)
+		assert.Equal(t, map[string]string{"X-Request-Id": "tid_1", "Message-Id": entries[i].ID}, msg.Headers)
+
+		expected, _ := json.Marshal(entries[i].Event)
+		assert.JSONEq(t, string(expected), string(msg.Value))
+	}
+	assert.Empty(t, broker.Messages("OtherTopic"))
+}
+
+func TestRESTProxyProducer(t *testing.T) {
+	var records []restProxyRecord
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/Unavailable/records") {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error_code":500,"message":"broker unavailable"}`))
+			return
+		}
+		// the records of a request are produced independently, each with a result of its own
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var record restProxyRecord
+			if err := dec.Decode(&record); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if record.Key.Data == "failing" {
+				_, _ = w.Write([]byte(`{"error_code":500,"message":"record too large"}`))
+				continue
+			}
+			records = append(records, record)
+			_, _ = w.Write([]byte(`{"error_code":200,"topic_name":"ConceptChanges","partition_id":0,"offset":1}`))
+		}
+	}))
+	defer server.Close()
+
+	producer := NewRESTProxyProducer(server.Client(), server.URL+"/", "cluster-1")
+	err := producer.Send(context.Background(), []Message{
+		{Topic: "ConceptChanges", Key: "uuid-1", Value: []byte(`{"uuid":"uuid-1"}`), Headers: map[string]string{"X-Request-Id": "tid_1"}},
+		{Topic: "ConceptChanges", Key: "uuid-2", Value: []byte(`{"uuid":"uuid-2"}`)},
+		{Topic: "OtherChanges", Key: "uuid-3", Value: []byte(`{"uuid":"uuid-3"}`)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/v3/clusters/cluster-1/topics/ConceptChanges/records", "/v3/clusters/cluster-1/topics/OtherChanges/records"}, paths,
+		"The messages to a topic should be sent in a single request")
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, restProxyData{Type: "STRING", Data: "uuid-1"}, records[0].Key)
+		assert.Equal(t, restProxyData{Type: "JSON", Data: map[string]interface{}{"uuid": "uuid-1"}}, records[0].Value)
+		assert.Equal(t, []restProxyHeader{{Name: "X-Request-Id", Value: []byte("tid_1")}}, records[0].Headers)
+		assert.Empty(t, records[1].Headers)
+		assert.Equal(t, restProxyData{Type: "STRING", Data: "uuid-3"}, records[2].Key)
+	}
+
+	err = producer.Send(context.Background(), []Message{
+		{Topic: "ConceptChanges", Key: "uuid-4", Value: []byte(`{}`)},
+		{Topic: "ConceptChanges", Key: "failing", Value: []byte(`{}`)},
+	})
+	assert.EqualError(t, err, "producing to topic ConceptChanges failed for message 2 of 2 with error code 500: record too large")
+
+	err = producer.Send(context.Background(), []Message{
+		{Topic: "Unavailable", Key: "uuid-5", Value: []byte(`{}`)},
+		{Topic: "ConceptChanges", Key: "uuid-6", Value: []byte(`{}`)},
+	})
+	assert.EqualError(t, err, "producing to topic Unavailable failed with status 500: broker unavailable")
+	assert.Len(t, records, 4, "No message should be sent after a failed request")
+}
+
+func TestEventPublisherCloudEvents(t *testing.T) {
+	broker := NewMemoryBroker()
+	publisher := NewEventPublisher(broker, "ConceptChanges", CloudEventsFormat)
+
+	entry := OutboxEntry{ID: "1", Event: Event{ConceptType: "Brand", ConceptUUID: "uuid-1", TransactionID: "tid_1", EventDetails: ConceptEvent{Type: UpdatedEvent}}}
+	err := publisher.Publish(context.Background(), []OutboxEntry{entry})
+	assert.NoError(t, err)
+
+	messages := broker.Messages("ConceptChanges")
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	assert.Equal(t, map[string]string{"X-Request-Id": "tid_1", "Message-Id": "1", "content-type": CloudEventContentType}, messages[0].Headers)
+	expected, _ := CloudEventsFormat.Encode(entry)
+	assert.JSONEq(t, string(expected), string(messages[0].Value))
+}
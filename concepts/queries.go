@@ -0,0 +1,46 @@
+package concepts
+
+import "context"
+
+// defaultMaxConcurrentQueries is the default size of the connection pool of the Neo4j driver, beyond which queries
+// could only wait for a connection anyway.
+const defaultMaxConcurrentQueries = 100
+
+// queryLimiter runs driver calls that can be abandoned once their context is done, bounding how many run at once so
+// that abandoned calls cannot pile up.
+type queryLimiter chan struct{}
+
+// newQueryLimiter returns a limiter running at most n calls at once, the default number when n is not positive
+func newQueryLimiter(n int) queryLimiter {
+	if n <= 0 {
+		n = defaultMaxConcurrentQueries
+	}
+	return make(queryLimiter, n)
+}
+
+// run runs fn, returning the context error as soon as the context is done.
+// The driver does not accept a context, so a cancelled context only stops the caller waiting: the abandoned call
+// carries on in the background, together with the goroutine running it and its slot of the limiter, until it
+// completes. Further calls wait for a slot until their context is done.
+// A write run this way must be safe to abandon, as whether it committed is unknown once its context is done.
+func (l queryLimiter) run(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() { <-l }()
+		errCh <- fn()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
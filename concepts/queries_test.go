@@ -0,0 +1,45 @@
+package concepts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLimiterAbandonedCallsHoldTheirSlot(t *testing.T) {
+	queries := newQueryLimiter(1)
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := queries.run(ctx, func() error {
+		defer close(done)
+		<-release
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "A call should stop waiting once its context is done")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := false
+	err = queries.run(ctx, func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "A call should wait for the slot of the abandoned call")
+	assert.False(t, called)
+
+	close(release)
+	<-done
+	assert.Eventually(t, func() bool {
+		return queries.run(context.Background(), func() error { return nil }) == nil
+	}, time.Second, time.Millisecond, "The slot should be freed once the abandoned call completes")
+}
+
+func TestQueryLimiterDefaultSize(t *testing.T) {
+	assert.Equal(t, defaultMaxConcurrentQueries, cap(newQueryLimiter(0)))
+	assert.Equal(t, 5, cap(newQueryLimiter(5)))
+}
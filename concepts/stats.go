@@ -0,0 +1,70 @@
+package concepts
+
+import (
+	"context"
+	"errors"
+
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+	"golang.org/x/exp/slices"
+)
+
+// TypeStats counts the stored concepts carrying the label of a concept type, which includes the concepts of its subtypes
+type TypeStats struct {
+	// Canonicals is the number of canonical nodes
+	Canonicals int `json:"canonicals"`
+	// Sources is the number of source nodes
+	Sources int `json:"sources"`
+	// Concordances is the number of canonical nodes with more than one source
+	Concordances int `json:"concordances"`
+	// LoneSources is the number of source nodes without a canonical node
+	LoneSources int `json:"loneSources"`
+	// Deprecated is the number of deprecated canonical nodes
+	Deprecated int `json:"deprecated"`
+}
+
+// labelStats counts the stored concepts carrying the same set of labels
+type labelStats struct {
+	Labels []string `json:"labels"`
+	TypeStats
+}
+
+// Stats counts the stored concepts of each of the given types. The concepts are counted in a single pass grouped by
+// their labels, which are then added up for every type they carry, rather than scanning the concepts of every type.
+func (s *ConceptService) Stats(ctx context.Context, types []string, transID string) (map[string]TypeStats, error) {
+	var results []labelStats
+	query := &cmneo4j.Query{
+		Cypher: `
+			MATCH (n:Concept)
+			OPTIONAL MATCH (n)-[:EQUIVALENT_TO]->(canonical)
+			WITH n, canonical, CASE WHEN n.prefUUID IS NULL THEN 0 ELSE size([(n)<-[:EQUIVALENT_TO]-(source) | source]) END AS sourceCount
+			RETURN
+				labels(n) AS labels,
+				sum(CASE WHEN n.prefUUID IS NOT NULL THEN 1 ELSE 0 END) AS canonicals,
+				sum(CASE WHEN n.uuid IS NOT NULL THEN 1 ELSE 0 END) AS sources,
+				sum(CASE WHEN sourceCount > 1 THEN 1 ELSE 0 END) AS concordances,
+				sum(CASE WHEN n.uuid IS NOT NULL AND canonical IS NULL THEN 1 ELSE 0 END) AS loneSources,
+				sum(CASE WHEN n.prefUUID IS NOT NULL AND n.isDeprecated = true THEN 1 ELSE 0 END) AS deprecated`,
+		Result: &results,
+	}
+
+	if err := s.runRead(ctx, query); err != nil && !errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		s.log.WithError(err).WithTransactionID(transID).Error("Counting concepts resulted in error")
+		return nil, err
+	}
+
+	stats := make(map[string]TypeStats, len(types))
+	for _, conceptType := range types {
+		var typeStats TypeStats
+		for _, result := range results {
+			if slices.Contains(result.Labels, conceptType) {
+				typeStats.Canonicals += result.Canonicals
+				typeStats.Sources += result.Sources
+				typeStats.Concordances += result.Concordances
+				typeStats.LoneSources += result.LoneSources
+				typeStats.Deprecated += result.Deprecated
+			}
+		}
+		stats[conceptType] = typeStats
+	}
+	return stats, nil
+}
@@ -0,0 +1,179 @@
+package concepts
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type mockSubscriptionStore struct {
+	mu            sync.Mutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]WebhookDelivery
+	deadLetters   []DeadLetter
+	err           error
+	// block makes the calls of the subscription handlers wait for their context to be done
+	block bool
+}
+
+func newMockSubscriptionStore(subs ...Subscription) *mockSubscriptionStore {
+	store := &mockSubscriptionStore{subscriptions: map[string]Subscription{}, deliveries: map[string]WebhookDelivery{}}
+	for _, sub := range subs {
+		store.subscriptions[sub.ID] = sub
+	}
+	return store
+}
+
+func (m *mockSubscriptionStore) List(ctx context.Context) ([]Subscription, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	subs := []Subscription{}
+	for _, sub := range m.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs, nil
+}
+
+func (m *mockSubscriptionStore) Get(ctx context.Context, id string) (Subscription, bool, error) {
+	if err := m.wait(ctx); err != nil {
+		return Subscription{}, false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return Subscription{}, false, m.err
+	}
+	sub, found := m.subscriptions[id]
+	return sub, found, nil
+}
+
+func (m *mockSubscriptionStore) Save(ctx context.Context, sub Subscription) error {
+	if err := m.wait(ctx); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.subscriptions[sub.ID] = sub
+	return nil
+}
+
+func (m *mockSubscriptionStore) Delete(ctx context.Context, id string) (bool, error) {
+	if err := m.wait(ctx); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return false, m.err
+	}
+	_, found := m.subscriptions[id]
+	delete(m.subscriptions, id)
+	for deliveryID, delivery := range m.deliveries {
+		if delivery.SubscriptionID == id {
+			delete(m.deliveries, deliveryID)
+		}
+	}
+	return found, nil
+}
+
+func (m *mockSubscriptionStore) AddDeadLetter(_ context.Context, letter DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.deadLetters = append(m.deadLetters, letter)
+	return nil
+}
+
+func (m *mockSubscriptionStore) DeadLetters(ctx context.Context, subscriptionID string) ([]DeadLetter, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	letters := []DeadLetter{}
+	for _, letter := range m.deadLetters {
+		if letter.SubscriptionID == subscriptionID {
+			letters = append(letters, letter)
+		}
+	}
+	return letters, nil
+}
+
+func (m *mockSubscriptionStore) AddDeliveries(_ context.Context, deliveries []WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	for _, delivery := range deliveries {
+		if _, found := m.deliveries[delivery.ID]; !found {
+			m.deliveries[delivery.ID] = delivery
+		}
+	}
+	return nil
+}
+
+func (m *mockSubscriptionStore) ClaimDeliveries(_ context.Context, subscriptionID, _ string, _ time.Duration, limit int) ([]WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range m.deliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Entry.ID < deliveries[j].Entry.ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *mockSubscriptionStore) UpdateDelivery(_ context.Context, delivery WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	if _, found := m.deliveries[delivery.ID]; found {
+		m.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+func (m *mockSubscriptionStore) RemoveDelivery(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	delete(m.deliveries, id)
+	return nil
+}
+
+func (m *mockSubscriptionStore) wait(ctx context.Context) error {
+	if !m.block {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,576 @@
+package concepts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+)
+
+// Subscription registers a URL to receive the concept change events matching its filters
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret is the key of the HMAC-SHA256 signature of every request, it is never returned once registered
+	Secret string `json:"secret,omitempty"`
+	// ConceptTypes and EventTypes filter the events, an empty list matching any type
+	ConceptTypes []string `json:"conceptTypes,omitempty"`
+	EventTypes   []string `json:"eventTypes,omitempty"`
+	// AnnotationsChangeOnly only matches the CONCEPT_CHANGE_LOG events of changes that can affect annotations
+	AnnotationsChangeOnly bool `json:"annotationsChangeOnly,omitempty"`
+}
+
+func (s Subscription) validate(allowedHosts []string) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if !hostAllowed(u.Hostname(), allowedHosts) {
+		return fmt.Errorf("webhooks cannot be registered for host %s", u.Hostname())
+	}
+	if s.Secret == "" {
+		return errors.New("secret is required to sign the requests")
+	}
+	return nil
+}
+
+// hostAllowed tells whether the host is one of the allowed hosts, an allowed host starting with "*." matching all of its
+// subdomains
+func hostAllowed(host string, allowedHosts []string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Subscription) matches(event Event) bool {
+	return eventFilter{conceptTypes: s.ConceptTypes, eventTypes: s.EventTypes, annotationsChangeOnly: s.AnnotationsChangeOnly}.matches(event)
+}
+
+// DeadLetter is an event which could not be delivered to a subscription
+type DeadLetter struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscriptionID"`
+	Event          Event     `json:"event"`
+	Error          string    `json:"error"`
+	Attempts       int       `json:"attempts"`
+	FailedAt       time.Time `json:"failedAt"`
+}
+
+// WebhookDelivery is an event waiting to be sent to a subscription
+type WebhookDelivery struct {
+	// ID is made of the subscription id and the outbox id of the event, so that an event is only queued once
+	ID             string
+	SubscriptionID string
+	Entry          OutboxEntry
+	// Attempts counts the attempts which failed so far
+	Attempts int
+	// NextAttempt is when the event can be sent again after a failed attempt
+	NextAttempt time.Time
+}
+
+// SubscriptionStore keeps the webhook subscriptions, the events waiting to be sent to them and the events that could not
+// be delivered to them
+type SubscriptionStore interface {
+	List(ctx context.Context) ([]Subscription, error)
+	Get(ctx context.Context, id string) (Subscription, bool, error)
+	// Save creates the subscription or replaces the one with the same id
+	Save(ctx context.Context, sub Subscription) error
+	Delete(ctx context.Context, id string) (bool, error)
+	AddDeadLetter(ctx context.Context, letter DeadLetter) error
+	DeadLetters(ctx context.Context, subscriptionID string) ([]DeadLetter, error)
+	// AddDeliveries queues the events for their subscriptions, ignoring the ones already queued
+	AddDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	// ClaimDeliveries leases the subscription to the owner and returns its oldest queued events, in order. Nothing is
+	// returned while another owner holds the lease.
+	ClaimDeliveries(ctx context.Context, subscriptionID, owner string, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// UpdateDelivery records the attempts of a queued event
+	UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error
+	// RemoveDelivery removes an event from the queue once delivered or dead-lettered
+	RemoveDelivery(ctx context.Context, id string) error
+}
+
+// Neo4jSubscriptionStore keeps the subscriptions as ConceptEventSubscription nodes, the events waiting to be sent to
+// them as ConceptEventDelivery nodes and their dead letters as ConceptEventDeadLetter nodes
+type Neo4jSubscriptionStore struct {
+	driver  *cmneo4j.Driver
+	queries queryLimiter
+}
+
+func NewNeo4jSubscriptionStore(driver *cmneo4j.Driver) *Neo4jSubscriptionStore {
+	return &Neo4jSubscriptionStore{driver: driver, queries: newQueryLimiter(defaultMaxConcurrentQueries)}
+}
+
+// Initialise creates the constraints of the subscription, delivery and dead letter nodes, and the index of the
+// subscription of the deliveries, if they are not already created.
+func (s *Neo4jSubscriptionStore) Initialise() error {
+	if err := s.driver.EnsureConstraints(map[string]string{
+		"ConceptEventSubscription": "id",
+		"ConceptEventDelivery":     "id",
+		"ConceptEventDeadLetter":   "id",
+	}); err != nil {
+		return err
+	}
+	return s.driver.EnsureIndexes(map[string]string{
+		"ConceptEventDelivery": "subscriptionID",
+	})
+}
+
+type subscriptionResult struct {
+	ID                    string   `json:"id"`
+	URL                   string   `json:"url"`
+	Secret                string   `json:"secret"`
+	ConceptTypes          []string `json:"conceptTypes"`
+	EventTypes            []string `json:"eventTypes"`
+	AnnotationsChangeOnly bool     `json:"annotationsChangeOnly"`
+}
+
+func (r subscriptionResult) subscription() Subscription {
+	return Subscription(r)
+}
+
+func (s *Neo4jSubscriptionStore) List(ctx context.Context) ([]Subscription, error) {
+	var result []subscriptionResult
+	err := s.queries.run(ctx, func() error {
+		return s.driver.Read(&cmneo4j.Query{
+			Cypher: `
+				MATCH (s:ConceptEventSubscription)
+				RETURN s.id AS id, s.url AS url, s.secret AS secret, s.conceptTypes AS conceptTypes, s.eventTypes AS eventTypes,
+					s.annotationsChangeOnly AS annotationsChangeOnly
+				ORDER BY id`,
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return []Subscription{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]Subscription, len(result))
+	for i, r := range result {
+		subs[i] = r.subscription()
+	}
+	return subs, nil
+}
+
+func (s *Neo4jSubscriptionStore) Get(ctx context.Context, id string) (Subscription, bool, error) {
+	var result subscriptionResult
+	err := s.queries.run(ctx, func() error {
+		return s.driver.Read(&cmneo4j.Query{
+			Cypher: `
+				MATCH (s:ConceptEventSubscription {id:$id})
+				RETURN s.id AS id, s.url AS url, s.secret AS secret, s.conceptTypes AS conceptTypes, s.eventTypes AS eventTypes,
+					s.annotationsChangeOnly AS annotationsChangeOnly`,
+			Params: map[string]interface{}{
+				"id": id,
+			},
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return Subscription{}, false, nil
+	}
+	if err != nil {
+		return Subscription{}, false, err
+	}
+	return result.subscription(), true, nil
+}
+
+func (s *Neo4jSubscriptionStore) Save(ctx context.Context, sub Subscription) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			MERGE (s:ConceptEventSubscription {id:$id})
+			SET s.url = $url, s.secret = $secret, s.conceptTypes = $conceptTypes, s.eventTypes = $eventTypes,
+				s.annotationsChangeOnly = $annotationsChangeOnly`,
+		Params: map[string]interface{}{
+			"id":                    sub.ID,
+			"url":                   sub.URL,
+			"secret":                sub.Secret,
+			"conceptTypes":          sub.ConceptTypes,
+			"eventTypes":            sub.EventTypes,
+			"annotationsChangeOnly": sub.AnnotationsChangeOnly,
+		},
+	})
+}
+
+// Delete removes the subscription together with its queued events and dead letters
+func (s *Neo4jSubscriptionStore) Delete(ctx context.Context, id string) (bool, error) {
+	_, found, err := s.Get(ctx, id)
+	if err != nil || !found {
+		return false, err
+	}
+	params := map[string]interface{}{
+		"id": id,
+	}
+	// the deliveries and dead letters are deleted by statements of their own, so that they are not matched against each
+	// other
+	err = s.driver.Write(
+		&cmneo4j.Query{
+			Cypher: `
+				MATCH (d:ConceptEventDelivery {subscriptionID:$id})
+				DETACH DELETE d`,
+			Params: params,
+		},
+		&cmneo4j.Query{
+			Cypher: `
+				MATCH (l:ConceptEventDeadLetter {subscriptionID:$id})
+				DETACH DELETE l`,
+			Params: params,
+		},
+		&cmneo4j.Query{
+			Cypher: `
+				MATCH (s:ConceptEventSubscription {id:$id})
+				DELETE s`,
+			Params: params,
+		},
+	)
+	return err == nil, err
+}
+
+func (s *Neo4jSubscriptionStore) AddDeadLetter(ctx context.Context, letter DeadLetter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	event, err := json.Marshal(letter.Event)
+	if err != nil {
+		return err
+	}
+	return s.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			CREATE (l:ConceptEventDeadLetter)
+			SET l = $letter`,
+		Params: map[string]interface{}{
+			"letter": map[string]interface{}{
+				"id":             letter.ID,
+				"subscriptionID": letter.SubscriptionID,
+				"event":          string(event),
+				"error":          letter.Error,
+				"attempts":       letter.Attempts,
+				"failedAt":       letter.FailedAt.UnixMilli(),
+			},
+		},
+	})
+}
+
+func (s *Neo4jSubscriptionStore) DeadLetters(ctx context.Context, subscriptionID string) ([]DeadLetter, error) {
+	var result []struct {
+		ID       string `json:"id"`
+		Event    string `json:"event"`
+		Error    string `json:"error"`
+		Attempts int    `json:"attempts"`
+		FailedAt int64  `json:"failedAt"`
+	}
+	err := s.queries.run(ctx, func() error {
+		return s.driver.Read(&cmneo4j.Query{
+			Cypher: `
+				MATCH (l:ConceptEventDeadLetter {subscriptionID:$id})
+				RETURN l.id AS id, l.event AS event, l.error AS error, l.attempts AS attempts, l.failedAt AS failedAt
+				ORDER BY failedAt`,
+			Params: map[string]interface{}{
+				"id": subscriptionID,
+			},
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return []DeadLetter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(result))
+	for _, r := range result {
+		var event Event
+		if err := json.Unmarshal([]byte(r.Event), &event); err != nil {
+			return nil, fmt.Errorf("decoding dead letter %s: %w", r.ID, err)
+		}
+		letters = append(letters, DeadLetter{
+			ID:             r.ID,
+			SubscriptionID: subscriptionID,
+			Event:          event,
+			Error:          r.Error,
+			Attempts:       r.Attempts,
+			FailedAt:       time.UnixMilli(r.FailedAt).UTC(),
+		})
+	}
+	return letters, nil
+}
+
+func (s *Neo4jSubscriptionStore) AddDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	params := make([]map[string]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		event, err := json.Marshal(delivery.Entry.Event)
+		if err != nil {
+			return err
+		}
+		params[i] = map[string]interface{}{
+			"id":             delivery.ID,
+			"subscriptionID": delivery.SubscriptionID,
+			"outboxID":       delivery.Entry.ID,
+			"writtenAt":      delivery.Entry.WrittenAt.UnixMilli(),
+			"event":          string(event),
+		}
+	}
+	return s.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			UNWIND $deliveries AS delivery
+			MERGE (d:ConceptEventDelivery {id:delivery.id})
+			ON CREATE SET d += delivery, d.attempts = 0, d.nextAttemptAt = 0`,
+		Params: map[string]interface{}{
+			"deliveries": params,
+		},
+	})
+}
+
+func (s *Neo4jSubscriptionStore) ClaimDeliveries(ctx context.Context, subscriptionID, owner string, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	var result []struct {
+		ID            string `json:"id"`
+		OutboxID      string `json:"outboxID"`
+		WrittenAt     int64  `json:"writtenAt"`
+		Event         string `json:"event"`
+		Attempts      int    `json:"attempts"`
+		NextAttemptAt int64  `json:"nextAttemptAt"`
+	}
+	err := s.queries.run(ctx, func() error {
+		// the deliveries are returned by the write taking the lease, as a read could go to a member that has not applied it
+		return s.driver.Write(&cmneo4j.Query{
+			Cypher: `
+				MATCH (s:ConceptEventSubscription {id:$id})
+				WHERE s.leaseOwner IS NULL OR s.leaseOwner = $owner OR s.leaseExpiresAt < timestamp()
+				SET s.leaseOwner = $owner, s.leaseExpiresAt = timestamp() + $lease
+				WITH s
+				MATCH (d:ConceptEventDelivery {subscriptionID:$id})
+				WITH d ORDER BY d.outboxID LIMIT $limit
+				RETURN d.id AS id, d.outboxID AS outboxID, d.writtenAt AS writtenAt, d.event AS event, d.attempts AS attempts, d.nextAttemptAt AS nextAttemptAt
+				ORDER BY outboxID`,
+			Params: map[string]interface{}{
+				"id":    subscriptionID,
+				"owner": owner,
+				"lease": lease.Milliseconds(),
+				"limit": limit,
+			},
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(result))
+	for _, r := range result {
+		var event Event
+		if err := json.Unmarshal([]byte(r.Event), &event); err != nil {
+			return nil, fmt.Errorf("decoding delivery %s: %w", r.ID, err)
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			ID:             r.ID,
+			SubscriptionID: subscriptionID,
+			Entry:          OutboxEntry{ID: r.OutboxID, Event: event, WrittenAt: time.UnixMilli(r.WrittenAt).UTC()},
+			Attempts:       r.Attempts,
+			NextAttempt:    time.UnixMilli(r.NextAttemptAt).UTC(),
+		})
+	}
+	return deliveries, nil
+}
+
+func (s *Neo4jSubscriptionStore) UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			MATCH (d:ConceptEventDelivery {id:$id})
+			SET d.attempts = $attempts, d.nextAttemptAt = $nextAttemptAt`,
+		Params: map[string]interface{}{
+			"id":            delivery.ID,
+			"attempts":      delivery.Attempts,
+			"nextAttemptAt": delivery.NextAttempt.UnixMilli(),
+		},
+	})
+}
+
+func (s *Neo4jSubscriptionStore) RemoveDelivery(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.driver.Write(&cmneo4j.Query{
+		Cypher: `
+			MATCH (d:ConceptEventDelivery {id:$id})
+			DELETE d`,
+		Params: map[string]interface{}{
+			"id": id,
+		},
+	})
+}
+
+func (h *ConceptsHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if !h.subscriptionsEnabled(w, r) {
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	subs, err := h.Subscriptions.List(ctx)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (h *ConceptsHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.subscriptionsEnabled(w, r) {
+		return
+	}
+	var sub Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := newToken()
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sub.ID = id
+	h.saveSubscription(w, r, sub, http.StatusCreated)
+}
+
+func (h *ConceptsHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.subscriptionsEnabled(w, r) {
+		return
+	}
+	sub, found := h.findSubscription(w, r)
+	if !found {
+		return
+	}
+	sub.Secret = ""
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *ConceptsHandler) PutSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.subscriptionsEnabled(w, r) {
+		return
+	}
+	existing, found := h.findSubscription(w, r)
+	if !found {
+		return
+	}
+	var sub Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub.ID = existing.ID
+	if sub.Secret == "" {
+		// the secret is never returned, so that clients can send back what they read without it
+		sub.Secret = existing.Secret
+	}
+	h.saveSubscription(w, r, sub, http.StatusOK)
+}
+
+func (h *ConceptsHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.subscriptionsEnabled(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	ctx, cancel := withTimeout(r.Context(), h.WriteTimeout)
+	defer cancel()
+	deleted, err := h.Subscriptions.Delete(ctx, id)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+	if !deleted {
+		writeJSONError(w, fmt.Sprintf("Subscription %s not found.", id), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ConceptsHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !h.subscriptionsEnabled(w, r) {
+		return
+	}
+	sub, found := h.findSubscription(w, r)
+	if !found {
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	letters, err := h.Subscriptions.DeadLetters(ctx, sub.ID)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, letters)
+}
+
+// subscriptionsEnabled sets the response headers and fails the request when no subscription store is configured
+func (h *ConceptsHandler) subscriptionsEnabled(w http.ResponseWriter, r *http.Request) bool {
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	if h.Subscriptions == nil {
+		writeJSONError(w, "webhook subscriptions are not enabled", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+func (h *ConceptsHandler) findSubscription(w http.ResponseWriter, r *http.Request) (Subscription, bool) {
+	id := mux.Vars(r)["id"]
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	sub, found, err := h.Subscriptions.Get(ctx, id)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return Subscription{}, false
+	}
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Subscription %s not found.", id), http.StatusNotFound)
+		return Subscription{}, false
+	}
+	return sub, true
+}
+
+func (h *ConceptsHandler) saveSubscription(w http.ResponseWriter, r *http.Request, sub Subscription, statusCode int) {
+	if err := sub.validate(h.WebhookHosts); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), h.WriteTimeout)
+	defer cancel()
+	if err := h.Subscriptions.Save(ctx, sub); err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err))
+		return
+	}
+	sub.Secret = ""
+	writeJSON(w, statusCode, sub)
+}
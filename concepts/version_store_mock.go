@@ -0,0 +1,57 @@
+package concepts
+
+import (
+	"context"
+	"sync"
+)
+
+type mockVersionStore struct {
+	mu sync.Mutex
+	// versions are kept in the order they were written
+	versions []ConceptVersion
+	err      error
+}
+
+func newMockVersionStore(versions ...ConceptVersion) *mockVersionStore {
+	return &mockVersionStore{versions: versions}
+}
+
+func (m *mockVersionStore) AddVersion(_ context.Context, version ConceptVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.versions = append(m.versions, version)
+	return nil
+}
+
+func (m *mockVersionStore) History(_ context.Context, prefUUID string) ([]ConceptVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	versions := []ConceptVersion{}
+	for i := len(m.versions) - 1; i >= 0; i-- {
+		if version := m.versions[i]; version.PrefUUID == prefUUID {
+			version.Concept = nil
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+func (m *mockVersionStore) Version(_ context.Context, prefUUID, aggregateHash string) (ConceptVersion, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return ConceptVersion{}, false, m.err
+	}
+	for i := len(m.versions) - 1; i >= 0; i-- {
+		if version := m.versions[i]; version.PrefUUID == prefUUID && version.AggregateHash == aggregateHash {
+			return version, true, nil
+		}
+	}
+	return ConceptVersion{}, false, nil
+}
@@ -0,0 +1,358 @@
+package concepts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	ontology "github.com/Financial-Times/cm-graph-ontology/v2"
+	cmneo4j "github.com/Financial-Times/cm-neo4j-driver"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+)
+
+// AuthorHeader names who made a write, as recorded in the version history of the concept
+const AuthorHeader = "X-Author"
+
+// ConceptVersion is a state of a canonical concept as it was written, with the changes from the previous version
+type ConceptVersion struct {
+	ID            string    `json:"id"`
+	PrefUUID      string    `json:"prefUUID"`
+	ConceptType   string    `json:"type"`
+	AggregateHash string    `json:"aggregateHash"`
+	TransactionID string    `json:"transactionID"`
+	Author        string    `json:"author,omitempty"`
+	WrittenAt     time.Time `json:"writtenAt"`
+	// ChangeLog is empty for the first version of the concept
+	ChangeLog ChangeLog `json:"changelog,omitempty"`
+	// Concept is only returned for a single version
+	Concept *ontology.CanonicalConcept `json:"concept,omitempty"`
+}
+
+// VersionStore keeps a bounded history of the states of every canonical concept
+type VersionStore interface {
+	// AddVersion stores the version, dropping the oldest versions of the concept beyond the size of the history
+	AddVersion(ctx context.Context, version ConceptVersion) error
+	// History returns the versions of the concept, latest first, without their concepts
+	History(ctx context.Context, prefUUID string) ([]ConceptVersion, error)
+	// Version returns the latest version of the concept with the given aggregate hash
+	Version(ctx context.Context, prefUUID, aggregateHash string) (ConceptVersion, bool, error)
+}
+
+// versionQuerier is implemented by the stores whose versions can be written in the same transaction as the concept
+type versionQuerier interface {
+	versionQuery(version ConceptVersion) (*cmneo4j.Query, error)
+}
+
+// WithVersionHistory records every write of a canonical concept in the version store, in the same transaction as the
+// concept itself when the store is kept in Neo4j
+func WithVersionHistory(store VersionStore) ServiceOption {
+	return func(s *ConceptService) {
+		s.versions = store
+	}
+}
+
+// newVersion returns the version of the concept being written, its changes being those of the change log event if any
+func newVersion(concept ontology.CanonicalConcept, changes ConceptChanges, transID string, opts WriteOptions) (ConceptVersion, error) {
+	token, err := newToken()
+	if err != nil {
+		return ConceptVersion{}, err
+	}
+	now := time.Now()
+	concept = cleanSourceProperties(concept)
+	version := ConceptVersion{
+		// the time comes first so that versions sort in the order they were written
+		ID:            fmt.Sprintf("%020d-%s", now.UnixNano(), token[:8]),
+		PrefUUID:      concept.PrefUUID,
+		ConceptType:   concept.Type,
+		TransactionID: transID,
+		Author:        opts.Author,
+		WrittenAt:     now.UTC(),
+		Concept:       &concept,
+	}
+	for _, event := range changes.ChangedRecords {
+		if event.ConceptUUID != concept.PrefUUID {
+			continue
+		}
+		switch details := event.EventDetails.(type) {
+		case ConceptEvent:
+			version.AggregateHash = event.AggregateHash
+		case ConceptChangeLogEvent:
+			version.ChangeLog = details.ChangeLog
+		}
+	}
+	version.Concept.AggregatedHash = version.AggregateHash
+	return version, nil
+}
+
+// Neo4jVersionStore keeps the versions as ConceptVersion nodes
+type Neo4jVersionStore struct {
+	driver  *cmneo4j.Driver
+	size    int
+	queries queryLimiter
+}
+
+// NewNeo4jVersionStore returns a store keeping the latest size versions of every concept
+func NewNeo4jVersionStore(driver *cmneo4j.Driver, size int) *Neo4jVersionStore {
+	return &Neo4jVersionStore{driver: driver, size: size, queries: newQueryLimiter(defaultMaxConcurrentQueries)}
+}
+
+// Initialise creates the constraint of the version nodes and the index of their prefUUID if they are not already
+// created.
+func (s *Neo4jVersionStore) Initialise() error {
+	if err := s.driver.EnsureConstraints(map[string]string{
+		"ConceptVersion": "id",
+	}); err != nil {
+		return err
+	}
+	return s.driver.EnsureIndexes(map[string]string{
+		"ConceptVersion": "prefUUID",
+	})
+}
+
+func (s *Neo4jVersionStore) versionQuery(version ConceptVersion) (*cmneo4j.Query, error) {
+	concept, err := json.Marshal(version.Concept)
+	if err != nil {
+		return nil, err
+	}
+	changelog, err := json.Marshal(version.ChangeLog)
+	if err != nil {
+		return nil, err
+	}
+	return &cmneo4j.Query{
+		Cypher: `
+			CREATE (v:ConceptVersion)
+			SET v = $version
+			WITH v.prefUUID AS prefUUID
+			MATCH (old:ConceptVersion {prefUUID:prefUUID})
+			WITH old ORDER BY old.id DESC
+			SKIP $size
+			DELETE old`,
+		Params: map[string]interface{}{
+			"version": map[string]interface{}{
+				"id":            version.ID,
+				"prefUUID":      version.PrefUUID,
+				"type":          version.ConceptType,
+				"aggregateHash": version.AggregateHash,
+				"transactionID": version.TransactionID,
+				"author":        version.Author,
+				"writtenAt":     version.WrittenAt.UnixMilli(),
+				"changelog":     string(changelog),
+				"concept":       string(concept),
+			},
+			"size": s.size,
+		},
+	}, nil
+}
+
+func (s *Neo4jVersionStore) AddVersion(ctx context.Context, version ConceptVersion) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	query, err := s.versionQuery(version)
+	if err != nil {
+		return err
+	}
+	return s.driver.Write(query)
+}
+
+type versionResult struct {
+	ID            string `json:"id"`
+	PrefUUID      string `json:"prefUUID"`
+	ConceptType   string `json:"type"`
+	AggregateHash string `json:"aggregateHash"`
+	TransactionID string `json:"transactionID"`
+	Author        string `json:"author"`
+	WrittenAt     int64  `json:"writtenAt"`
+	ChangeLog     string `json:"changelog"`
+	Concept       string `json:"concept"`
+}
+
+func (r versionResult) version() (ConceptVersion, error) {
+	version := ConceptVersion{
+		ID:            r.ID,
+		PrefUUID:      r.PrefUUID,
+		ConceptType:   r.ConceptType,
+		AggregateHash: r.AggregateHash,
+		TransactionID: r.TransactionID,
+		Author:        r.Author,
+		WrittenAt:     time.UnixMilli(r.WrittenAt).UTC(),
+	}
+	if r.ChangeLog != "" {
+		if err := json.Unmarshal([]byte(r.ChangeLog), &version.ChangeLog); err != nil {
+			return ConceptVersion{}, fmt.Errorf("decoding the changelog of version %s: %w", r.ID, err)
+		}
+	}
+	if r.Concept != "" {
+		var concept ontology.CanonicalConcept
+		if err := json.Unmarshal([]byte(r.Concept), &concept); err != nil {
+			return ConceptVersion{}, fmt.Errorf("decoding the concept of version %s: %w", r.ID, err)
+		}
+		version.Concept = &concept
+	}
+	return version, nil
+}
+
+func (s *Neo4jVersionStore) History(ctx context.Context, prefUUID string) ([]ConceptVersion, error) {
+	var result []versionResult
+	err := s.queries.run(ctx, func() error {
+		return s.driver.Read(&cmneo4j.Query{
+			Cypher: `
+				MATCH (v:ConceptVersion {prefUUID:$uuid})
+				RETURN v.id AS id, v.prefUUID AS prefUUID, v.type AS type, v.aggregateHash AS aggregateHash,
+					v.transactionID AS transactionID, v.author AS author, v.writtenAt AS writtenAt, v.changelog AS changelog
+				ORDER BY id DESC`,
+			Params: map[string]interface{}{
+				"uuid": prefUUID,
+			},
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return []ConceptVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]ConceptVersion, 0, len(result))
+	for _, r := range result {
+		version, err := r.version()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func (s *Neo4jVersionStore) Version(ctx context.Context, prefUUID, aggregateHash string) (ConceptVersion, bool, error) {
+	var result versionResult
+	err := s.queries.run(ctx, func() error {
+		return s.driver.Read(&cmneo4j.Query{
+			Cypher: `
+				MATCH (v:ConceptVersion {prefUUID:$uuid, aggregateHash:$hash})
+				RETURN v.id AS id, v.prefUUID AS prefUUID, v.type AS type, v.aggregateHash AS aggregateHash,
+					v.transactionID AS transactionID, v.author AS author, v.writtenAt AS writtenAt, v.changelog AS changelog,
+					v.concept AS concept
+				ORDER BY id DESC
+				LIMIT 1`,
+			Params: map[string]interface{}{
+				"uuid": prefUUID,
+				"hash": aggregateHash,
+			},
+			Result: &result,
+		})
+	})
+	if errors.Is(err, cmneo4j.ErrNoResultsFound) {
+		return ConceptVersion{}, false, nil
+	}
+	if err != nil {
+		return ConceptVersion{}, false, err
+	}
+	version, err := result.version()
+	return version, err == nil, err
+}
+
+func (h *ConceptsHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.versionsEnabled(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	versions, err := h.Versions.History(ctx, uuid)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+	if len(versions) == 0 {
+		writeJSONError(w, fmt.Sprintf("No history found for concept with prefUUID %s.", uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err := checkConceptTypeAgainstPath(versions[0].ConceptType, vars["concept_type"]); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+func (h *ConceptsHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	if !h.versionsEnabled(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+	hash := vars["hash"]
+
+	ctx, cancel := withTimeout(r.Context(), h.ReadTimeout)
+	defer cancel()
+	version, found, err := h.Versions.Version(ctx, uuid, hash)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Version %s of concept with prefUUID %s not found.", hash, uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err := checkConceptTypeAgainstPath(version.ConceptType, vars["concept_type"]); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf("%q", version.AggregateHash))
+	writeJSON(w, http.StatusOK, version)
+}
+
+// RollbackConcept writes the version of the concept with the aggregate hash given as toHash again, as if it had been
+// PUT, so that concordances are transferred and events are emitted as for any other write
+func (h *ConceptsHandler) RollbackConcept(w http.ResponseWriter, r *http.Request) {
+	if !h.versionsEnabled(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	uuid := vars["uuid"]
+	hash := r.URL.Query().Get("toHash")
+	if hash == "" {
+		writeJSONError(w, "toHash is required", http.StatusBadRequest, uuid)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), h.WriteTimeout)
+	defer cancel()
+	version, found, err := h.Versions.Version(ctx, uuid, hash)
+	if err != nil {
+		writeJSONError(w, err.Error(), serviceErrorStatus(err), uuid)
+		return
+	}
+	if !found || version.Concept == nil {
+		writeJSONError(w, fmt.Sprintf("Version %s of concept with prefUUID %s not found.", hash, uuid), http.StatusNotFound, uuid)
+		return
+	}
+	if err := checkConceptTypeAgainstPath(version.ConceptType, vars["concept_type"]); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest, uuid)
+		return
+	}
+
+	concept := *version.Concept
+	// the aggregate hash is worked out by the write, as for a PUT
+	concept.AggregatedHash = ""
+	h.writeConcept(ctx, w, r, concept, transactionidutils.GetTransactionIDFromRequest(r))
+}
+
+// versionsEnabled sets the response headers and fails the request when no version store is configured
+func (h *ConceptsHandler) versionsEnabled(w http.ResponseWriter, r *http.Request) bool {
+	transID := transactionidutils.GetTransactionIDFromRequest(r)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", transID)
+
+	if h.Versions == nil {
+		writeJSONError(w, "the version history is not enabled", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package concepts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    versionResult
+		changeLog ChangeLog
+		err       string
+	}{
+		{
+			name:   "EmptyChangeLog",
+			result: versionResult{ID: "v1"},
+		},
+		{
+			name:      "ChangeLog",
+			result:    versionResult{ID: "v2", ChangeLog: `[{"op":"update","path":"/prefLabel","from":"old","to":"new"}]`},
+			changeLog: ChangeLog{{Op: "update", Path: "/prefLabel", From: "old", To: "new"}},
+		},
+		{
+			name:   "InvalidChangeLog",
+			result: versionResult{ID: "v3", ChangeLog: "not json"},
+			err:    "decoding the changelog of version v3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, err := test.result.version()
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err, "Versions without a changelog should be decoded")
+			assert.Equal(t, test.result.ID, version.ID)
+			assert.Equal(t, test.changeLog, version.ChangeLog)
+			assert.Nil(t, version.Concept)
+		})
+	}
+}
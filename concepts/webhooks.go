@@ -0,0 +1,316 @@
+package concepts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultWebhookMaxAttempts    = 5
+	defaultWebhookInitialBackoff = time.Second
+	defaultWebhookPollInterval   = time.Second
+	// webhookLease is how long a replica delivers to a subscription before another replica can take over
+	webhookLease = time.Minute
+	// webhookBatchSize is how many events are read at once for a subscription
+	webhookBatchSize = 100
+	// webhookStoreTimeout bounds the calls made to the subscription store while delivering events
+	webhookStoreTimeout = 10 * time.Second
+	// SignatureHeader holds the hex encoded HMAC-SHA256 signature of the request body, keyed by the subscription secret
+	SignatureHeader = "X-Signature-256"
+)
+
+// WebhookConfig configures a WebhookSink, zero values meaning the defaults
+type WebhookConfig struct {
+	// MaxAttempts is how many times an event is sent before it is dead-lettered
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubling after every attempt
+	InitialBackoff time.Duration
+	// PollInterval is how often the subscriptions are checked for events to send
+	PollInterval time.Duration
+	// Format is the representation of the events sent to the subscribers
+	Format EventFormat
+}
+
+// WebhookSink is an EventSink queuing every event in the subscription store for the subscriptions it matches, so that
+// the events are only acknowledged once they cannot be lost.
+// The queued events are sent in order in the background, each subscription on its own so that a slow or failing
+// subscriber does not hold back the others. An event still failing after all its attempts is added to the dead letters
+// of the subscription. Changes to the subscriptions apply from the next batch of events sent to them.
+type WebhookSink struct {
+	store  SubscriptionStore
+	client *http.Client
+	log    *logger.UPPLogger
+	config WebhookConfig
+	// owner identifies the sink in the leases it takes on the subscriptions
+	owner string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	// sending holds the ids of the subscriptions being delivered to
+	sending map[string]bool
+
+	delivered    metrics.Counter
+	deadLettered metrics.Counter
+}
+
+// NewWebhookSink returns a sink sending the events queued in the store until it is closed
+func NewWebhookSink(store SubscriptionStore, client *http.Client, log *logger.UPPLogger, config WebhookConfig) (*WebhookSink, error) {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaultWebhookInitialBackoff
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultWebhookPollInterval
+	}
+	owner, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WebhookSink{
+		store:        store,
+		client:       client,
+		log:          log,
+		config:       config,
+		owner:        owner,
+		ctx:          ctx,
+		cancel:       cancel,
+		sending:      map[string]bool{},
+		delivered:    metrics.GetOrRegisterCounter("webhook-events-delivered", metrics.DefaultRegistry),
+		deadLettered: metrics.GetOrRegisterCounter("webhook-events-dead-lettered", metrics.DefaultRegistry),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// Publish queues the events for the subscriptions they match.
+func (s *WebhookSink) Publish(ctx context.Context, entries []OutboxEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookStoreTimeout)
+	defer cancel()
+	subs, err := s.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []WebhookDelivery
+	for _, entry := range entries {
+		for _, sub := range subs {
+			if sub.matches(entry.Event) {
+				deliveries = append(deliveries, WebhookDelivery{ID: sub.ID + ":" + entry.ID, SubscriptionID: sub.ID, Entry: entry})
+			}
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.store.AddDeliveries(ctx, deliveries)
+}
+
+// Close stops delivering events and waits for the deliveries in progress.
+func (s *WebhookSink) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *WebhookSink) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		s.poll()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll starts sending the queued events of every subscription which is not already being sent to.
+func (s *WebhookSink) poll() {
+	ctx, cancel := context.WithTimeout(s.ctx, webhookStoreTimeout)
+	defer cancel()
+	subs, err := s.store.List(ctx)
+	if err != nil {
+		s.log.WithError(err).Error("Could not read the webhook subscriptions")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range subs {
+		if s.sending[sub.ID] {
+			continue
+		}
+		s.sending[sub.ID] = true
+		s.wg.Add(1)
+		go s.deliver(sub)
+	}
+}
+
+// deliver claims the subscription and sends its queued events in order, until one of them has to wait for its next
+// attempt or none are left. The subscription is read again between batches, so that it stops being sent to soon after
+// being deleted.
+func (s *WebhookSink) deliver(sub Subscription) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sending, sub.ID)
+		s.mu.Unlock()
+	}()
+
+	logEntry := s.log.WithField("subscriptionID", sub.ID)
+	for {
+		claimed := time.Now()
+		ctx, cancel := context.WithTimeout(s.ctx, webhookStoreTimeout)
+		deliveries, err := s.store.ClaimDeliveries(ctx, sub.ID, s.owner, webhookLease, webhookBatchSize)
+		cancel()
+		if err != nil {
+			logEntry.WithError(err).Error("Could not read the events to send to subscriber")
+			return
+		}
+
+		for _, delivery := range deliveries {
+			// stop early enough for the last request to complete within the lease
+			if s.ctx.Err() != nil || time.Since(claimed) > webhookLease/2 || time.Now().Before(delivery.NextAttempt) {
+				return
+			}
+			if !s.attempt(sub, delivery) {
+				return
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+
+		var found bool
+		ctx, cancel = context.WithTimeout(s.ctx, webhookStoreTimeout)
+		sub, found, err = s.store.Get(ctx, sub.ID)
+		cancel()
+		if err != nil {
+			logEntry.WithError(err).Error("Could not read the webhook subscription")
+			return
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// attempt sends the event once and records the outcome, returning whether the next event can be sent.
+func (s *WebhookSink) attempt(sub Subscription, delivery WebhookDelivery) bool {
+	cause := s.send(sub, delivery.Entry)
+	if cause != nil && s.ctx.Err() != nil {
+		// closing, the attempt does not count
+		return false
+	}
+
+	logEntry := s.log.WithTransactionID(delivery.Entry.Event.TransactionID).
+		WithUUID(delivery.Entry.Event.ConceptUUID).
+		WithField("subscriptionID", sub.ID).
+		WithField("outboxID", delivery.Entry.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), webhookStoreTimeout)
+	defer cancel()
+
+	delivery.Attempts++
+	if cause != nil && delivery.Attempts < s.config.MaxAttempts {
+		delivery.NextAttempt = time.Now().Add(s.config.InitialBackoff << (delivery.Attempts - 1))
+		if err := s.store.UpdateDelivery(ctx, delivery); err != nil {
+			logEntry.WithError(err).Error("Could not record the failed attempt to send the concept change event")
+		}
+		return false
+	}
+
+	if cause != nil {
+		logEntry.WithError(cause).Warn("Could not deliver concept change event to subscriber")
+		if err := s.deadLetter(ctx, delivery, cause); err != nil {
+			logEntry.WithError(err).Error("Could not store undelivered concept change event")
+			return false
+		}
+		s.deadLettered.Inc(1)
+	} else {
+		s.delivered.Inc(1)
+	}
+	if err := s.store.RemoveDelivery(ctx, delivery.ID); err != nil {
+		logEntry.WithError(err).Error("Could not remove the concept change event sent, it will be sent again")
+		return false
+	}
+	return true
+}
+
+func (s *WebhookSink) send(sub Subscription, entry OutboxEntry) error {
+	body, err := s.config.Format.Encode(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.config.Format.ContentType())
+	req.Header.Set("X-Request-Id", entry.Event.TransactionID)
+	req.Header.Set("Message-Id", entry.ID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(sub.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *WebhookSink) deadLetter(ctx context.Context, delivery WebhookDelivery, cause error) error {
+	id, err := newToken()
+	if err != nil {
+		return err
+	}
+	return s.store.AddDeadLetter(ctx, DeadLetter{
+		ID:             id,
+		SubscriptionID: delivery.SubscriptionID,
+		Event:          delivery.Entry.Event,
+		Error:          cause.Error(),
+		Attempts:       delivery.Attempts,
+		FailedAt:       time.Now().UTC(),
+	})
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body, keyed by the secret, which subscribers can compare with the
+// signature header of the requests they receive.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MultiEventSink publishes the events to all of its sinks in turn, failing as soon as one of them fails
+type MultiEventSink []EventSink
+
+func (m MultiEventSink) Publish(ctx context.Context, entries []OutboxEntry) error {
+	for _, sink := range m {
+		if err := sink.Publish(ctx, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
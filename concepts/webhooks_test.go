@@ -0,0 +1,210 @@
+package concepts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	received := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != "sha256="+Sign("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		mu.Unlock()
+		// the flaky subscriber only accepts the third attempt
+		if r.URL.Path == "/failing" || (r.URL.Path == "/flaky" && attempt < 3) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received <- r
+	}))
+	defer server.Close()
+
+	store := newMockSubscriptionStore(
+		Subscription{ID: "flaky", URL: server.URL + "/flaky", Secret: "s3cret", ConceptTypes: []string{"Brand"}},
+		Subscription{ID: "failing", URL: server.URL + "/failing", Secret: "s3cret"},
+		Subscription{ID: "unsigned", URL: server.URL + "/unsigned", Secret: "wrong"},
+		Subscription{ID: "people", URL: server.URL + "/people", Secret: "s3cret", ConceptTypes: []string{"Person"}},
+	)
+	sink, err := NewWebhookSink(store, server.Client(), logger.NewUPPLogger("test-concepts-rw-neo4j", "PANIC"), WebhookConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		PollInterval:   10 * time.Millisecond,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sink.Close()
+
+	entry := OutboxEntry{ID: "outbox-1", Event: Event{ConceptType: "Brand", ConceptUUID: "uuid-1", TransactionID: "tid_1", EventDetails: ConceptEvent{Type: UpdatedEvent}}}
+	err = sink.Publish(context.Background(), []OutboxEntry{entry})
+	assert.NoError(t, err)
+
+	select {
+	case r := <-received:
+		assert.Equal(t, "/flaky", r.URL.Path)
+		assert.Equal(t, "tid_1", r.Header.Get("X-Request-Id"))
+		assert.Equal(t, "outbox-1", r.Header.Get("Message-Id"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("The event was not delivered to the flaky subscriber")
+	}
+
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.deadLetters) == 2
+	}, 5*time.Second, 10*time.Millisecond, "The events which could not be delivered should be dead-lettered")
+
+	for _, id := range []string{"failing", "unsigned"} {
+		letters, err := store.DeadLetters(context.Background(), id)
+		assert.NoError(t, err)
+		if assert.Len(t, letters, 1) {
+			assert.Equal(t, 3, letters[0].Attempts)
+			assert.Equal(t, "uuid-1", letters[0].Event.ConceptUUID)
+			assert.Contains(t, letters[0].Error, "status")
+		}
+	}
+	mu.Lock()
+	assert.Zero(t, attempts["/people"], "Events should only be sent to the subscriptions they match")
+	mu.Unlock()
+	store.mu.Lock()
+	assert.Empty(t, store.deliveries, "Events should be removed from the queue once delivered or dead-lettered")
+	store.mu.Unlock()
+}
+
+func TestWebhookSinkQueuesEvents(t *testing.T) {
+	store := newMockSubscriptionStore(
+		Subscription{ID: "brands", URL: "https://example.com/brands", Secret: "s3cret", ConceptTypes: []string{"Brand"}},
+		Subscription{ID: "people", URL: "https://example.com/people", Secret: "s3cret", ConceptTypes: []string{"Person"}},
+	)
+	// not started, so that the queued events stay in the store
+	sink := &WebhookSink{store: store}
+
+	entries := []OutboxEntry{
+		{ID: "outbox-1", Event: Event{ConceptType: "Brand", ConceptUUID: "uuid-1"}},
+		{ID: "outbox-2", Event: Event{ConceptType: "Topic", ConceptUUID: "uuid-2"}},
+	}
+	assert.NoError(t, sink.Publish(context.Background(), entries))
+	assert.NoError(t, sink.Publish(context.Background(), entries), "Publishing the events again should not fail")
+	assert.Equal(t, map[string]WebhookDelivery{
+		"brands:outbox-1": {ID: "brands:outbox-1", SubscriptionID: "brands", Entry: entries[0]},
+	}, store.deliveries, "The events should be queued once for the subscriptions they match before being acknowledged")
+
+	store.err = errors.New("TEST failing to QUEUE")
+	assert.Error(t, sink.Publish(context.Background(), entries), "The relay should retry the events when they cannot be queued")
+}
+
+func TestWebhookSinkDeletedSubscription(t *testing.T) {
+	sent := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := newMockSubscriptionStore(Subscription{ID: "down", URL: server.URL, Secret: "s3cret"})
+	sink, err := NewWebhookSink(store, server.Client(), logger.NewUPPLogger("test-concepts-rw-neo4j", "PANIC"), WebhookConfig{
+		InitialBackoff: time.Hour,
+		PollInterval:   10 * time.Millisecond,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sink.Close()
+
+	assert.NoError(t, sink.Publish(context.Background(), []OutboxEntry{{ID: "outbox-1", Event: Event{ConceptUUID: "uuid-1"}}}))
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The event was not sent")
+	}
+
+	deleted, err := store.Delete(context.Background(), "down")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Eventually(t, func() bool {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return len(sink.sending) == 0
+	}, 5*time.Second, 10*time.Millisecond, "Nothing should be kept running for a subscription waiting to retry")
+	store.mu.Lock()
+	assert.Empty(t, store.deliveries, "The queued events of a deleted subscription should be removed")
+	store.mu.Unlock()
+	assert.Len(t, sent, 0, "The event should not be sent again before its next attempt")
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"example.com", "*.hooks.example.org"}
+	tests := map[string]bool{
+		"example.com":               true,
+		"EXAMPLE.com":               true,
+		"api.example.com":           false,
+		"a.hooks.example.org":       true,
+		"hooks.example.org":         false,
+		"evilhooks.example.org":     false,
+		"169.254.169.254":           false,
+		"localhost":                 false,
+		"example.com.attacker.test": false,
+	}
+	for host, expected := range tests {
+		assert.Equal(t, expected, hostAllowed(host, allowed), host)
+	}
+	assert.False(t, hostAllowed("example.com", nil), "No host should be allowed by default")
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	sub := Subscription{ConceptTypes: []string{"Brand"}, AnnotationsChangeOnly: true}
+	changed := func(annotationsChange bool) Event {
+		return Event{ConceptType: "Brand", EventDetails: ConceptChangeLogEvent{Type: ChangeLogEvent, AnnotationsChange: annotationsChange}}
+	}
+	assert.True(t, sub.matches(changed(true)))
+	assert.False(t, sub.matches(changed(false)), "Changes not affecting annotations should be filtered out")
+	assert.False(t, sub.matches(Event{ConceptType: "Brand", EventDetails: ConceptEvent{Type: UpdatedEvent}}), "Events without a changelog should be filtered out")
+	// events read back from the outbox have their details decoded as a map
+	assert.True(t, sub.matches(Event{ConceptType: "Brand", EventDetails: map[string]interface{}{"eventType": ChangeLogEvent, "annotationsChange": true}}))
+	assert.False(t, sub.matches(Event{ConceptType: "Person", EventDetails: ConceptChangeLogEvent{Type: ChangeLogEvent, AnnotationsChange: true}}))
+
+	sub.AnnotationsChangeOnly = false
+	assert.True(t, sub.matches(changed(false)))
+}
+
+func TestWebhookSinkStoreError(t *testing.T) {
+	store := newMockSubscriptionStore()
+	store.err = errors.New("TEST failing to LIST")
+	sink := &WebhookSink{store: store}
+
+	err := sink.Publish(context.Background(), []OutboxEntry{{ID: "outbox-1", Event: Event{ConceptUUID: "uuid-1"}}})
+	assert.EqualError(t, err, "TEST failing to LIST", "The relay should retry the events when the subscriptions cannot be read")
+}
+
+func TestMultiEventSink(t *testing.T) {
+	first, second := NewMemoryBroker(), NewMemoryBroker()
+	failing := &WebhookSink{store: &mockSubscriptionStore{err: errors.New("TEST failing to LIST")}}
+	entries := []OutboxEntry{{ID: "outbox-1", Event: Event{ConceptUUID: "uuid-1"}}}
+
+	err := MultiEventSink{NewEventPublisher(first, "ConceptChanges", NativeEventFormat), NewEventPublisher(second, "ConceptChanges", NativeEventFormat)}.Publish(context.Background(), entries)
+	assert.NoError(t, err)
+	assert.Len(t, first.Messages("ConceptChanges"), 1)
+	assert.Len(t, second.Messages("ConceptChanges"), 1)
+
+	err = MultiEventSink{failing, NewEventPublisher(first, "ConceptChanges", NativeEventFormat)}.Publish(context.Background(), entries)
+	assert.Error(t, err)
+	assert.Len(t, first.Messages("ConceptChanges"), 1, "No sink should be published to after a failure")
+}
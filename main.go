@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -73,9 +74,153 @@ func main() {
 	annotationsChangeFields := app.Strings(cli.StringsOpt{
 		Name:   "annotationsChangeFields",
 		Value:  []string{"prefUUID", "prefLabel", "type", "leiCode", "figiCode", "issuedBy", "geonamesFeatureCode", "isDeprecated"},
-		Desc:   "Fields that can cause annotations changes if updated",
+		Desc:   "Fields that can cause annotations changes if updated, ignored when an annotations rules file is given",
 		EnvVar: "ANNOTATIONS_CHANGE_FIELDS",
 	})
+	annotationsRulesFile := app.String(cli.StringOpt{
+		Name:   "annotationsRulesFile",
+		Value:  "",
+		Desc:   "JSON file of the rules deciding which concept changes can cause annotations changes, reloaded on SIGHUP",
+		EnvVar: "ANNOTATIONS_RULES_FILE",
+	})
+	concordancePolicyFile := app.String(cli.StringOpt{
+		Name:   "concordancePolicyFile",
+		Value:  "",
+		Desc:   "JSON file of the policy deciding which authorities can take over the concordances of another",
+		EnvVar: "CONCORDANCE_POLICY_FILE",
+	})
+	bulkWriteConcurrency := app.Int(cli.IntOpt{
+		Name:   "bulkWriteConcurrency",
+		Value:  4,
+		Desc:   "Number of concepts written in parallel by the bulk endpoint",
+		EnvVar: "BULK_WRITE_CONCURRENCY",
+	})
+	bulkMaxBodySizeMB := app.Int(cli.IntOpt{
+		Name:   "bulkMaxBodySizeMB",
+		Value:  256,
+		Desc:   "Largest request body in megabytes accepted by the bulk endpoint, 0 meaning no limit",
+		EnvVar: "BULK_MAX_BODY_SIZE_MB",
+	})
+	writeLockTimeout := app.String(cli.StringOpt{
+		Name:   "writeLockTimeout",
+		Value:  "10s",
+		Desc:   "How long a write waits for concurrent writes of the same concepts to complete before failing",
+		EnvVar: "WRITE_LOCK_TIMEOUT",
+	})
+	graphWriteLocks := app.Bool(cli.BoolOpt{
+		Name:   "graphWriteLocks",
+		Value:  false,
+		Desc:   "Whether to coordinate concurrent writes of the same concepts across replicas using lock nodes in Neo4j",
+		EnvVar: "GRAPH_WRITE_LOCKS",
+	})
+	readTimeout := app.String(cli.StringOpt{
+		Name:   "readTimeout",
+		Value:  "10s",
+		Desc:   "How long a concept read can take before failing, 0 meaning no limit",
+		EnvVar: "READ_TIMEOUT",
+	})
+	writeTimeout := app.String(cli.StringOpt{
+		Name:   "writeTimeout",
+		Value:  "30s",
+		Desc:   "How long a concept write can take before failing, 0 meaning no limit",
+		EnvVar: "WRITE_TIMEOUT",
+	})
+	deleteTimeout := app.String(cli.StringOpt{
+		Name:   "deleteTimeout",
+		Value:  "30s",
+		Desc:   "How long a concept delete can take before failing, 0 meaning no limit",
+		EnvVar: "DELETE_TIMEOUT",
+	})
+	maxConcurrentQueries := app.Int(cli.IntOpt{
+		Name:   "maxConcurrentQueries",
+		Value:  100,
+		Desc:   "How many concept reads run at once, the abandoned ones included, 0 meaning the size of the driver's connection pool",
+		EnvVar: "MAX_CONCURRENT_QUERIES",
+	})
+	eventOutbox := app.Bool(cli.BoolOpt{
+		Name:   "eventOutbox",
+		Value:  false,
+		Desc:   "Whether to store the events of every write and delete in an outbox in Neo4j and relay them from there",
+		EnvVar: "EVENT_OUTBOX",
+	})
+	outboxPollInterval := app.String(cli.StringOpt{
+		Name:   "outboxPollInterval",
+		Value:  "1s",
+		Desc:   "How often the outbox is checked for events to relay",
+		EnvVar: "OUTBOX_POLL_INTERVAL",
+	})
+	outboxRetention := app.String(cli.StringOpt{
+		Name:   "outboxRetention",
+		Value:  "168h",
+		Desc:   "How long relayed events are kept in the outbox",
+		EnvVar: "OUTBOX_RETENTION",
+	})
+	changesSettleLag := app.String(cli.StringOpt{
+		Name:   "changesSettleLag",
+		Value:  "35s",
+		Desc:   "How long after being written events are read again by the change feed, which should be longer than the write and delete timeouts plus the clock skew between replicas",
+		EnvVar: "CHANGES_SETTLE_LAG",
+	})
+	kafkaProxyURL := app.String(cli.StringOpt{
+		Name:   "kafkaProxyURL",
+		Value:  "",
+		Desc:   "URL of the Kafka REST proxy to publish concept change events through, which enables the event outbox",
+		EnvVar: "KAFKA_PROXY_URL",
+	})
+	kafkaClusterID := app.String(cli.StringOpt{
+		Name:   "kafkaClusterID",
+		Value:  "",
+		Desc:   "ID of the Kafka cluster to publish concept change events to",
+		EnvVar: "KAFKA_CLUSTER_ID",
+	})
+	conceptEventsTopic := app.String(cli.StringOpt{
+		Name:   "conceptEventsTopic",
+		Value:  "ConceptChanges",
+		Desc:   "Kafka topic to publish concept change events to",
+		EnvVar: "CONCEPT_EVENTS_TOPIC",
+	})
+	eventFormat := app.String(cli.StringOpt{
+		Name:   "eventFormat",
+		Value:  "native",
+		Desc:   "Representation of the concept change events delivered from the outbox, either native or cloudevents",
+		EnvVar: "EVENT_FORMAT",
+	})
+	webhooks := app.Bool(cli.BoolOpt{
+		Name:   "webhooks",
+		Value:  false,
+		Desc:   "Whether to deliver concept change events to the webhooks registered at /__subscriptions, which enables the event outbox",
+		EnvVar: "WEBHOOKS",
+	})
+	webhookMaxAttempts := app.Int(cli.IntOpt{
+		Name:   "webhookMaxAttempts",
+		Value:  5,
+		Desc:   "How many times an event is sent to a webhook before it is added to the dead letters of the subscription",
+		EnvVar: "WEBHOOK_MAX_ATTEMPTS",
+	})
+	webhookInitialBackoff := app.String(cli.StringOpt{
+		Name:   "webhookInitialBackoff",
+		Value:  "1s",
+		Desc:   "How long to wait before sending an event to a webhook again, doubling after every attempt",
+		EnvVar: "WEBHOOK_INITIAL_BACKOFF",
+	})
+	webhookHosts := app.Strings(cli.StringsOpt{
+		Name:   "webhookHosts",
+		Value:  []string{},
+		Desc:   "Hosts webhooks can be registered for, a host starting with *. allowing all its subdomains, no webhook being accepted when empty",
+		EnvVar: "WEBHOOK_HOSTS",
+	})
+	concordanceConflicts := app.Bool(cli.BoolOpt{
+		Name:   "concordanceConflicts",
+		Value:  false,
+		Desc:   "Whether to keep the concordance conflicts rejecting writes in Neo4j, listed by /__conflicts",
+		EnvVar: "CONCORDANCE_CONFLICTS",
+	})
+	versionHistorySize := app.Int(cli.IntOpt{
+		Name:   "versionHistorySize",
+		Value:  0,
+		Desc:   "How many versions of every concept are kept in its history, 0 disabling the version history",
+		EnvVar: "VERSION_HISTORY_SIZE",
+	})
 
 	log := logger.NewUPPLogger(*appSystemCode, *logLevel)
 	dbDriverLog := logger.NewUPPLogger(*appSystemCode+"-cmneo4j-driver", *dbDriverLogLevel)
@@ -85,19 +230,125 @@ func main() {
 			log.WithError(err).WithField("neoURL", *neoURL).Fatal("Could not create a cmneo4j driver")
 		}
 
-		conceptsService := concepts.NewConceptService(driver, log, *annotationsChangeFields)
+		serviceOpts := []concepts.ServiceOption{
+			concepts.WithWriteLockTimeout(mustParseDuration(log, "writeLockTimeout", *writeLockTimeout)),
+			concepts.WithMaxConcurrentQueries(*maxConcurrentQueries),
+		}
+		if *graphWriteLocks {
+			serviceOpts = append(serviceOpts, concepts.WithGraphWriteLocks())
+		}
+		format, err := concepts.ParseEventFormat(*eventFormat)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid event format")
+		}
+		var sink concepts.EventSink = concepts.LogEventSink{Log: log, Format: format}
+		if *kafkaProxyURL != "" {
+			producer := concepts.NewRESTProxyProducer(&http.Client{Timeout: 10 * time.Second}, *kafkaProxyURL, *kafkaClusterID)
+			sink = concepts.NewEventPublisher(producer, *conceptEventsTopic, format)
+			// events are only published from the outbox, so that they are not lost when publishing fails
+			*eventOutbox = true
+		}
+		var subscriptions concepts.SubscriptionStore
+		if *webhooks {
+			store := concepts.NewNeo4jSubscriptionStore(driver)
+			if err := store.Initialise(); err != nil {
+				log.WithError(err).Fatal("Failed to initialise the webhook subscriptions")
+			}
+			client := &http.Client{
+				Timeout: 10 * time.Second,
+				// only the registered hosts are sent events, not the ones they redirect to
+				CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			}
+			webhookSink, err := concepts.NewWebhookSink(store, client, log, concepts.WebhookConfig{
+				MaxAttempts:    *webhookMaxAttempts,
+				InitialBackoff: mustParseDuration(log, "webhookInitialBackoff", *webhookInitialBackoff),
+				Format:         format,
+			})
+			if err != nil {
+				log.WithError(err).Fatal("Failed to start delivering to the webhooks")
+			}
+			defer webhookSink.Close()
+			sink = concepts.MultiEventSink{sink, webhookSink}
+			subscriptions = store
+			*eventOutbox = true
+		}
+		if *eventOutbox {
+			serviceOpts = append(serviceOpts, concepts.WithEventOutbox())
+		}
+		var versions concepts.VersionStore
+		if *versionHistorySize > 0 {
+			store := concepts.NewNeo4jVersionStore(driver, *versionHistorySize)
+			if err := store.Initialise(); err != nil {
+				log.WithError(err).Fatal("Failed to initialise the version history")
+			}
+			serviceOpts = append(serviceOpts, concepts.WithVersionHistory(store))
+			versions = store
+		}
+		var conflicts concepts.ConflictStore
+		if *concordanceConflicts {
+			store := concepts.NewNeo4jConflictStore(driver)
+			if err := store.Initialise(); err != nil {
+				log.WithError(err).Fatal("Failed to initialise the concordance conflict report")
+			}
+			serviceOpts = append(serviceOpts, concepts.WithConflictReport(store))
+			conflicts = store
+		}
+		if *annotationsRulesFile != "" {
+			rules, err := concepts.LoadAnnotationsRules(*annotationsRulesFile)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to load the annotations rules")
+			}
+			go reloadOnHangup(log, rules)
+			serviceOpts = append(serviceOpts, concepts.WithAnnotationsRules(rules))
+		}
+		concordancePolicy := concepts.DefaultConcordancePolicy()
+		if *concordancePolicyFile != "" {
+			concordancePolicy, err = concepts.LoadConcordancePolicy(*concordancePolicyFile)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to load the concordance policy")
+			}
+			serviceOpts = append(serviceOpts, concepts.WithConcordancePolicy(concordancePolicy))
+		}
+
+		conceptsService := concepts.NewConceptService(driver, log, *annotationsChangeFields, serviceOpts...)
 		err = conceptsService.Initialise()
 		if err != nil {
 			log.WithError(err).Fatal("Failed to initialise ConceptService")
 		}
 
+		if *eventOutbox {
+			relay, err := concepts.NewOutboxRelay(driver, sink, log, concepts.OutboxRelayConfig{
+				PollInterval: mustParseDuration(log, "outboxPollInterval", *outboxPollInterval),
+				Retention:    mustParseDuration(log, "outboxRetention", *outboxRetention),
+			})
+			if err != nil {
+				log.WithError(err).Fatal("Failed to create the outbox relay")
+			}
+			relayCtx, stopRelay := context.WithCancel(context.Background())
+			defer stopRelay()
+			go relay.Run(relayCtx)
+		}
+
 		appConf := ServerConf{
 			AppSystemCode:    *appSystemCode,
 			AppName:          *appName,
 			Port:             *port,
 			RequestLoggingOn: *requestLoggingOn,
 		}
-		handler := concepts.ConceptsHandler{ConceptsService: &conceptsService}
+		handler := concepts.ConceptsHandler{
+			ConceptsService:   &conceptsService,
+			BulkConcurrency:   *bulkWriteConcurrency,
+			BulkMaxBodySize:   int64(*bulkMaxBodySizeMB) << 20,
+			ReadTimeout:       mustParseDuration(log, "readTimeout", *readTimeout),
+			WriteTimeout:      mustParseDuration(log, "writeTimeout", *writeTimeout),
+			DeleteTimeout:     mustParseDuration(log, "deleteTimeout", *deleteTimeout),
+			ChangesSettleLag:  mustParseDuration(log, "changesSettleLag", *changesSettleLag),
+			Subscriptions:     subscriptions,
+			WebhookHosts:      *webhookHosts,
+			Versions:          versions,
+			Conflicts:         conflicts,
+			ConcordancePolicy: &concordancePolicy,
+		}
 		runServerWithParams(handler, appConf, log)
 	}
 	log.WithField("args", os.Args).Info("Application started")
@@ -110,9 +361,14 @@ func runServerWithParams(handler concepts.ConceptsHandler, appConf ServerConf, l
 	handler.RegisterHandlers(router)
 	serveMux := handler.RegisterAdminHandlers(router, log, appConf.AppSystemCode, appConf.AppName, appDescription, appConf.RequestLoggingOn)
 
+	// requestsCtx is the parent of every request context, so that in-flight Neo4j work can be abandoned on shutdown
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	server := &http.Server{
-		Addr:    ":" + strconv.Itoa(appConf.Port),
-		Handler: serveMux,
+		Addr:        ":" + strconv.Itoa(appConf.Port),
+		Handler:     serveMux,
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
 	}
 
 	go func() {
@@ -127,12 +383,36 @@ func runServerWithParams(handler concepts.ConceptsHandler, appConf ServerConf, l
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	// give in-flight requests most of the shutdown period to complete, then cancel them so they can still respond
+	cancelTimer := time.AfterFunc(25*time.Second, cancelRequests)
+	defer cancelTimer.Stop()
 
 	if err := server.Shutdown(ctx); err != nil {
 		log.WithError(err).Fatalf("Failed to gracefully shutdown the server")
 	}
 }
 
+func mustParseDuration(log *logger.UPPLogger, name, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.WithError(err).WithField(name, value).Fatalf("Invalid duration for %s", name)
+	}
+	return d
+}
+
+// reloadOnHangup reloads the annotations rules from their file whenever the process receives SIGHUP
+func reloadOnHangup(log *logger.UPPLogger, rules *concepts.AnnotationsRules) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := rules.Reload(); err != nil {
+			log.WithError(err).Error("Failed to reload the annotations rules, keeping the current ones")
+			continue
+		}
+		log.Info("Reloaded the annotations rules")
+	}
+}
+
 func waitForSignal() {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)